@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AdaptiveLimit configures a RateLimiter to learn the rate an upstream will sustain, for APIs that
+// don't publish their limits. Like TCP congestion control, the rate grows additively while
+// requests succeed, and is cut multiplicatively when the server responds with a 429 or 503. The
+// learned rate settles just under the server's real limit, rather than repeatedly exceeding it.
+//
+// The zero value disables adaptive limiting.
+type AdaptiveLimit struct {
+
+	// InitialRate is the rate, in requests per second, used before anything has been learned. An
+	// InitialRate of zero (or less) disables adaptive limiting.
+	InitialRate float64
+
+	// MinRate is the lowest the rate may be cut to. If MinRate is zero, the rate may fall as low as
+	// one request per minute.
+	MinRate float64
+
+	// MaxRate is the highest the rate may grow to. Zero means no maximum.
+	MaxRate float64
+
+	// Increase is how quickly the rate grows while requests succeed. Each successful response
+	// adds Increase / rate to the rate, which works out to roughly Increase requests per second,
+	// per second spent sending at the current rate. If Increase is zero, 1 is used.
+	Increase float64
+
+	// Decrease is the factor the rate is multiplied by when the server responds with a 429 or
+	// 503. If Decrease is not between 0 and 1, 0.5 is used.
+	Decrease float64
+
+	// Burst is the maximum number of requests that may be sent at once. Burst is treated as 1 if
+	// it is less than 1.
+	Burst int
+}
+
+func (a AdaptiveLimit) enabled() bool {
+	return a.InitialRate > 0
+}
+
+func (a AdaptiveLimit) minRate() float64 {
+	if a.MinRate <= 0 {
+		return 1.0 / 60
+	}
+	return a.MinRate
+}
+
+func (a AdaptiveLimit) clamp(rate float64) float64 {
+	if rate < a.minRate() {
+		rate = a.minRate()
+	}
+	if a.MaxRate > 0 && rate > a.MaxRate {
+		rate = a.MaxRate
+	}
+	return rate
+}
+
+func (a AdaptiveLimit) increase() float64 {
+	if a.Increase <= 0 {
+		return 1
+	}
+	return a.Increase
+}
+
+func (a AdaptiveLimit) decrease() float64 {
+	if a.Decrease <= 0 || a.Decrease >= 1 {
+		return 0.5
+	}
+	return a.Decrease
+}
+
+// ################################
+// #### private adaptive stuff ####
+// ################################
+
+// adaptiveRate tracks the rate learned under an AdaptiveLimit, and applies it to a tokenBucket.
+type adaptiveRate struct {
+	lock         sync.Mutex
+	config       AdaptiveLimit
+	rate         float64
+	lastDecrease time.Time
+}
+
+// configure enables (or disables) adaptive limiting. The learned rate is kept, unless the config
+// has changed. Disabling leaves the bucket's limit for the caller to set.
+func (ar *adaptiveRate) configure(a AdaptiveLimit, bucket *tokenBucket, now time.Time) {
+	ar.lock.Lock()
+	defer ar.lock.Unlock()
+
+	if a != ar.config {
+		ar.config = a
+		ar.rate = a.clamp(a.InitialRate)
+		ar.lastDecrease = time.Time{}
+	}
+	if a.enabled() {
+		bucket.setLimit(ar.limit(), now)
+	}
+}
+
+// observe adjusts the learned rate, given the outcome of a request sent at `sentAt`.
+func (ar *adaptiveRate) observe(
+	sentAt time.Time,
+	status int,
+	retry bool,
+	bucket *tokenBucket,
+	now time.Time,
+) {
+	ar.lock.Lock()
+	defer ar.lock.Unlock()
+
+	if !ar.config.enabled() {
+		return
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		// Requests sent before the last cut were sent at the old rate, so they say nothing about
+		// the new one. Like TCP, only cut once per round of requests.
+		if sentAt.Before(ar.lastDecrease) {
+			return
+		}
+		ar.rate = ar.config.clamp(ar.rate * ar.config.decrease())
+		ar.lastDecrease = now
+
+	case !retry && status < http.StatusBadRequest:
+		ar.rate = ar.config.clamp(ar.rate + ar.config.increase()/ar.rate)
+
+	default:
+		return
+	}
+
+	bucket.setLimit(ar.limit(), now)
+}
+
+// limit returns the Limit corresponding to the learned rate. Callers must hold ar.lock.
+func (ar *adaptiveRate) limit() Limit {
+	if !ar.config.enabled() {
+		return Limit{}
+	}
+	return Limit{Rate: ar.rate, Burst: ar.config.Burst}
+}
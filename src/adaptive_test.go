@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveRateIncreasesOnSuccess(t *testing.T) {
+	rl := RateLimiter{}
+	now := time.Now()
+	rl.SetAdaptiveLimit(AdaptiveLimit{InitialRate: 4, MaxRate: 5})
+	assert.InDelta(t, 4.0, rl.Rate(), 1e-9)
+
+	rl.adaptive.observe(now, 200, false, &rl.bucket, now)
+	assert.InDelta(t, 4.25, rl.Rate(), 1e-9)
+
+	// retried and client error responses aren't evidence either way
+	rl.adaptive.observe(now, 200, true, &rl.bucket, now)
+	rl.adaptive.observe(now, 404, false, &rl.bucket, now)
+	assert.InDelta(t, 4.25, rl.Rate(), 1e-9)
+
+	for i := 0; i < 10; i++ {
+		rl.adaptive.observe(now, 200, false, &rl.bucket, now)
+	}
+	assert.InDelta(t, 5.0, rl.Rate(), 1e-9)
+}
+
+func TestAdaptiveRateDecreasesOncePerRound(t *testing.T) {
+	rl := RateLimiter{}
+	sent := time.Now()
+	rl.SetAdaptiveLimit(AdaptiveLimit{InitialRate: 8, MinRate: 1})
+
+	cut := sent.Add(time.Second)
+	rl.adaptive.observe(sent, 429, true, &rl.bucket, cut)
+	assert.InDelta(t, 4.0, rl.Rate(), 1e-9)
+
+	// sent before the cut, so this was sent at the old rate
+	rl.adaptive.observe(sent, 503, true, &rl.bucket, cut.Add(time.Second))
+	assert.InDelta(t, 4.0, rl.Rate(), 1e-9)
+
+	for i := 0; i < 5; i++ {
+		now := cut.Add(time.Duration(i+1) * time.Second)
+		rl.adaptive.observe(now, 429, true, &rl.bucket, now)
+	}
+	assert.InDelta(t, 1.0, rl.Rate(), 1e-9)
+}
+
+func TestAdaptiveRateKeptAcrossCalls(t *testing.T) {
+	rl := RateLimiter{}
+	now := time.Now()
+	a := AdaptiveLimit{InitialRate: 8}
+
+	rl.SetAdaptiveLimit(a)
+	rl.adaptive.observe(now, 429, true, &rl.bucket, now)
+	rl.SetAdaptiveLimit(a)
+	assert.InDelta(t, 4.0, rl.Rate(), 1e-9)
+
+	a.InitialRate = 2
+	rl.SetAdaptiveLimit(a)
+	assert.InDelta(t, 2.0, rl.Rate(), 1e-9)
+
+	rl.SetLimit(Limit{Rate: 10})
+	rl.adaptive.observe(now, 429, true, &rl.bucket, now)
+	assert.InDelta(t, 10.0, rl.Rate(), 1e-9)
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"net/http"
+	"time"
+)
+
+// Attempt records the outcome of a single attempt at sending a request. Unlike the
+// *http.Response itself, an Attempt is cheap to hold on to for the duration of a request.
+type Attempt struct {
+
+	// StatusCode is the status code of the attempt's response, or 0 if the attempt failed.
+	StatusCode int
+
+	// Header is a snapshot of the attempt's response headers, or nil if the attempt failed.
+	Header http.Header
+
+	// Err is the error the attempt failed with, if any.
+	Err error
+
+	// Wait is how long the attempt waited on the RateLimiter before it was sent.
+	Wait time.Duration
+
+	// Duration is how long the attempt took, from sending the request until the response headers
+	// (or an error) were received.
+	Duration time.Duration
+}
+
+// AttemptPolicy describes the retry and rate limiting policy for a Client, like RetryAfterPolicy.
+// Rather than every previous response, AttemptPolicy receives a record of every previous attempt
+// at the same request (including those that failed without a response).
+//
+// AttemptPolicy should return true if resp indicates a retry, and a non-zero time if requests
+// should retry after a specific time.
+type AttemptPolicy func(
+	resp *http.Response,
+	prevAttempts []Attempt,
+) (retry bool, after time.Time)
+
+// AttemptPolicy adapts a RetryAfterPolicy to an AttemptPolicy. The adapted policy receives a
+// stand-in response (with the status code and headers, but no body) for each previous attempt
+// that received a response.
+func (p RetryAfterPolicy) AttemptPolicy() AttemptPolicy {
+	return func(resp *http.Response, prevAttempts []Attempt) (bool, time.Time) {
+		var prevResps []*http.Response
+		for _, a := range prevAttempts {
+			if a.Err == nil {
+				prevResps = append(prevResps, a.response())
+			}
+		}
+		return p(resp, prevResps...)
+	}
+}
+
+func (a Attempt) response() *http.Response {
+	return &http.Response{
+		Status:     http.StatusText(a.StatusCode),
+		StatusCode: a.StatusCode,
+		Header:     a.Header,
+		Body:       http.NoBody,
+	}
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/maath"
+)
+
+// Jitter describes how randomness is applied to a Backoff, so that many clients failing at the
+// same time don't all retry in lockstep.
+//
+// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/ for a
+// comparison of the strategies.
+type Jitter int
+
+const (
+	// NoJitter waits exactly Base * 2^N.
+	NoJitter Jitter = iota
+
+	// FullJitter waits a random duration between 0 and Base * 2^N.
+	FullJitter
+
+	// EqualJitter waits half of Base * 2^N, plus a random duration up to the other half.
+	EqualJitter
+
+	// DecorrelatedJitter waits a random duration between Base and Base * 3^N. Unlike the
+	// original formulation, which grows from the previous (random) wait, the upper bound is
+	// derived from N alone, since policies don't know how long previous attempts waited.
+	DecorrelatedJitter
+)
+
+// Backoff configures exponential backoff, for use with ExponentialBackoffWith and
+// IdiomaticRetryAfterWith.
+//
+// The zero value waits 1, 2, 4, 8... seconds, without jitter, matching ExponentialBackoff.
+type Backoff struct {
+
+	// Base is the wait before the first retry. If Base is zero, 1 second is used.
+	Base time.Duration
+
+	// Cap is the maximum wait between retries. If Cap is zero, the wait is not capped.
+	Cap time.Duration
+
+	// Jitter is the jitter strategy applied to each wait.
+	Jitter Jitter
+
+	// Rand returns a pseudo-random number in [0.0, 1.0), and must be safe for concurrent use. If
+	// Rand is nil, math/rand.Float64 is used. Tests may inject a deterministic source.
+	Rand func() float64
+}
+
+// Duration returns the wait before the next retry, given the number of previous attempts.
+func (b Backoff) Duration(prevAttempts int) time.Duration {
+	n := uint64(maath.MaxInt(prevAttempts, 0))
+	base := b.base()
+
+	var d time.Duration
+	switch b.Jitter {
+	case FullJitter:
+		d = b.random(0, b.capped(b.exponential(n)))
+	case EqualJitter:
+		half := b.capped(b.exponential(n)) / 2
+		d = half + b.random(0, half)
+	case DecorrelatedJitter:
+		upper := b.capped(time.Duration(maath.SaturatingPow(uint64(base), 3, n, maxDuration)))
+		d = b.random(base, upper)
+	default:
+		d = b.exponential(n)
+	}
+
+	return b.capped(d)
+}
+
+// exponential returns Base * 2^n, without jitter or Cap.
+func (b Backoff) exponential(n uint64) time.Duration {
+	return time.Duration(maath.SaturatingPow(uint64(b.base()), 2, n, maxDuration))
+}
+
+func (b Backoff) base() time.Duration {
+	if b.Base <= 0 {
+		return time.Second
+	}
+	return b.Base
+}
+
+func (b Backoff) capped(d time.Duration) time.Duration {
+	if b.Cap > 0 && d > b.Cap {
+		return b.Cap
+	}
+	return d
+}
+
+// random returns a random duration in [lo, hi).
+func (b Backoff) random(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+
+	random := b.Rand
+	if random == nil {
+		random = rand.Float64
+	}
+	return lo + time.Duration(random()*float64(hi-lo))
+}
+
+const maxDuration = uint64(1<<63 - 1)
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/testutils"
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+	"github.com/stretchr/testify/assert"
+)
+
+func half() float64 { return 0.5 }
+
+func TestBackoffNoJitter(t *testing.T) {
+	b := Backoff{}
+	assert.Equal(t, 1*time.Second, b.Duration(0))
+	assert.Equal(t, 2*time.Second, b.Duration(1))
+	assert.Equal(t, 8*time.Second, b.Duration(3))
+
+	b = Backoff{Base: 100 * time.Millisecond, Cap: 1 * time.Second}
+	assert.Equal(t, 100*time.Millisecond, b.Duration(0))
+	assert.Equal(t, 800*time.Millisecond, b.Duration(3))
+	assert.Equal(t, 1*time.Second, b.Duration(4))
+	assert.Equal(t, 1*time.Second, b.Duration(1000)) // no overflow
+}
+
+func TestBackoffFullJitter(t *testing.T) {
+	b := Backoff{Jitter: FullJitter, Rand: half}
+	assert.Equal(t, 500*time.Millisecond, b.Duration(0))
+	assert.Equal(t, 4*time.Second, b.Duration(3))
+
+	b.Cap = 2 * time.Second
+	assert.Equal(t, 1*time.Second, b.Duration(3))
+}
+
+func TestBackoffEqualJitter(t *testing.T) {
+	b := Backoff{Jitter: EqualJitter, Rand: half}
+	assert.Equal(t, 750*time.Millisecond, b.Duration(0))
+	assert.Equal(t, 6*time.Second, b.Duration(3))
+}
+
+func TestBackoffDecorrelatedJitter(t *testing.T) {
+	b := Backoff{Jitter: DecorrelatedJitter, Rand: half}
+	assert.Equal(t, 1*time.Second, b.Duration(0))
+	assert.Equal(t, 2*time.Second, b.Duration(1))  // between 1s and 3s
+	assert.Equal(t, 14*time.Second, b.Duration(3)) // between 1s and 27s
+
+	b.Cap = 10 * time.Second
+	assert.Equal(t, 5500*time.Millisecond, b.Duration(3))
+}
+
+func TestBackoffIsRandom(t *testing.T) {
+	b := Backoff{Jitter: FullJitter}
+	for i := 0; i < 100; i++ {
+		d := b.Duration(4)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.Less(t, d, 16*time.Second)
+	}
+}
+
+func TestExponentialBackoffWith(t *testing.T) {
+	policy := ExponentialBackoffWith(Backoff{Jitter: FullJitter, Rand: half})
+	now := time.Now()
+
+	tyme.FreezeTimeAt(now, func() {
+		retry, after := policy(
+			testutils.StubResponse(429, ""),
+			testutils.StubResponse(429, ""),
+			testutils.StubResponse(429, ""),
+		)
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(2*time.Second), after)
+	})
+}
+
+func TestIdiomaticRetryAfterWith(t *testing.T) {
+	policy := IdiomaticRetryAfterWith(Backoff{Jitter: EqualJitter, Rand: half})
+	now := time.Now()
+
+	tyme.FreezeTimeAt(now, func() {
+		retry, after := policy(testutils.StubResponse(503, ""))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(750*time.Millisecond), after)
+
+		// Retry-After headers are honored exactly.
+		retry, after = policy(testutils.StubResponse(503, "", "Retry-After", "10"))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(10*time.Second), after)
+	})
+}
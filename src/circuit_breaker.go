@@ -0,0 +1,219 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreaker configures a per host circuit breaker for MultiHostClient. When too many requests
+// to a host fail (with a 5xx status, or without a response at all), the circuit "opens", and
+// requests to that host fail fast with a *CircuitOpenError rather than retrying and backing off.
+// After CoolDown, the circuit is "half-open": a few probe requests are let through, and if they
+// succeed, the circuit closes again.
+//
+// The zero value disables the circuit breaker.
+type CircuitBreaker struct {
+
+	// FailureRatio is the fraction of requests (between 0 and 1) which must fail within Window for
+	// the circuit to open. A FailureRatio of zero (or less) disables the circuit breaker.
+	FailureRatio float64
+
+	// MinRequests is the number of requests which must be sent within Window before FailureRatio
+	// is considered, so that a single failure doesn't open the circuit. If MinRequests is zero, 5
+	// is used.
+	MinRequests int
+
+	// Window is the period over which failures are counted. If Window is zero, 1 minute is used.
+	Window time.Duration
+
+	// CoolDown is how long the circuit stays open before letting probe requests through. If
+	// CoolDown is zero, 30 seconds is used.
+	CoolDown time.Duration
+
+	// HalfOpenProbes is the number of probe requests let through while half-open. All of them
+	// must succeed for the circuit to close, and any failure reopens it. If HalfOpenProbes is
+	// zero, 1 is used.
+	HalfOpenProbes int
+}
+
+func (cb CircuitBreaker) enabled() bool {
+	return cb.FailureRatio > 0
+}
+
+func (cb CircuitBreaker) minRequests() int {
+	if cb.MinRequests <= 0 {
+		return 5
+	}
+	return cb.MinRequests
+}
+
+func (cb CircuitBreaker) window() time.Duration {
+	if cb.Window <= 0 {
+		return 1 * time.Minute
+	}
+	return cb.Window
+}
+
+func (cb CircuitBreaker) coolDown() time.Duration {
+	if cb.CoolDown <= 0 {
+		return 30 * time.Second
+	}
+	return cb.CoolDown
+}
+
+func (cb CircuitBreaker) halfOpenProbes() int {
+	if cb.HalfOpenProbes <= 0 {
+		return 1
+	}
+	return cb.HalfOpenProbes
+}
+
+// CircuitState is the state of a host's circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests through, counting failures.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen fails requests fast, until the cool down has passed.
+	CircuitOpen
+
+	// CircuitHalfOpen lets a limited number of probe requests through, to decide whether to close
+	// the circuit again.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// #################################
+// # private circuit breaker stuff #
+// #################################
+
+type circuitOutcome int
+
+const (
+	circuitSucceeded circuitOutcome = iota
+	circuitFailed
+	circuitAbandoned // the request was never sent
+)
+
+// circuitBreaker tracks the state of a single host's circuit. Like semaphore, the configuration
+// is passed to each call rather than stored, so that it follows the owning client. The zero
+// value is a closed circuit.
+type circuitBreaker struct {
+	lock        sync.Mutex
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int // probes let through since going half-open
+	successes   int // probes that have succeeded since going half-open
+}
+
+// allow reports whether a request may be sent. If so, the request's outcome must be passed to
+// `record` along with `probe`.
+func (cb *circuitBreaker) allow(cfg CircuitBreaker, now time.Time) (probe bool, err error) {
+	if !cfg.enabled() {
+		return false, nil
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		reopensAt := cb.openedAt.Add(cfg.coolDown())
+		if now.Before(reopensAt) {
+			return false, &CircuitOpenError{State: CircuitOpen, RetryAt: reopensAt}
+		}
+		cb.state = CircuitHalfOpen
+		cb.probes, cb.successes = 0, 0
+		fallthrough
+
+	case CircuitHalfOpen:
+		if cb.probes >= cfg.halfOpenProbes() {
+			return false, &CircuitOpenError{State: CircuitHalfOpen}
+		}
+		cb.probes++
+		return true, nil
+
+	default:
+		if now.Sub(cb.windowStart) >= cfg.window() {
+			cb.windowStart = now
+			cb.requests, cb.failures = 0, 0
+		}
+		return false, nil
+	}
+}
+
+// record updates the circuit with the outcome of a request let through by `allow`.
+func (cb *circuitBreaker) record(
+	cfg CircuitBreaker,
+	probe bool,
+	outcome circuitOutcome,
+	now time.Time,
+) {
+	if !cfg.enabled() {
+		return
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	switch {
+	case probe && cb.state == CircuitHalfOpen:
+		switch outcome {
+		case circuitFailed:
+			cb.open(now)
+		case circuitAbandoned:
+			cb.probes-- // let another request probe in its place
+		default:
+			cb.successes++
+			if cb.successes >= cfg.halfOpenProbes() {
+				cb.state = CircuitClosed
+				cb.windowStart = now
+				cb.requests, cb.failures = 0, 0
+			}
+		}
+
+	case !probe && cb.state == CircuitClosed && outcome != circuitAbandoned:
+		cb.requests++
+		if outcome == circuitFailed {
+			cb.failures++
+		}
+		if cb.requests >= cfg.minRequests() &&
+			float64(cb.failures) >= cfg.FailureRatio*float64(cb.requests) {
+			cb.open(now)
+		}
+	}
+
+	// anything else finished after the circuit changed state, and says nothing about the new one.
+}
+
+// currentState returns the state of the circuit, as `allow` would see it at `now`.
+func (cb *circuitBreaker) currentState(cfg CircuitBreaker, now time.Time) CircuitState {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	if cb.state == CircuitOpen && !now.Before(cb.openedAt.Add(cfg.coolDown())) {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
+
+func (cb *circuitBreaker) open(now time.Time) {
+	cb.state = CircuitOpen
+	cb.openedAt = now
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerOpensOnFailureRatio(t *testing.T) {
+	cfg := CircuitBreaker{FailureRatio: 0.5, MinRequests: 4}
+	cb := circuitBreaker{}
+	now := time.Now()
+
+	for _, outcome := range []circuitOutcome{circuitFailed, circuitFailed, circuitFailed} {
+		probe, err := cb.allow(cfg, now)
+		assert.Nil(t, err)
+		cb.record(cfg, probe, outcome, now)
+	}
+	assert.Equal(t, CircuitClosed, cb.currentState(cfg, now)) // not enough requests yet
+
+	cb.allow(cfg, now)
+	cb.record(cfg, false, circuitSucceeded, now)
+	assert.Equal(t, CircuitOpen, cb.currentState(cfg, now))
+
+	_, err := cb.allow(cfg, now.Add(time.Second))
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	var openErr *CircuitOpenError
+	if assert.True(t, errors.As(err, &openErr)) {
+		assert.Equal(t, now.Add(30*time.Second), openErr.RetryAt)
+	}
+}
+
+func TestCircuitBreakerWindowResets(t *testing.T) {
+	cfg := CircuitBreaker{FailureRatio: 0.5, MinRequests: 2, Window: time.Second}
+	cb := circuitBreaker{}
+	now := time.Now()
+
+	cb.allow(cfg, now)
+	cb.record(cfg, false, circuitFailed, now)
+
+	later := now.Add(2 * time.Second)
+	cb.allow(cfg, later)
+	cb.record(cfg, false, circuitSucceeded, later)
+	assert.Equal(t, CircuitClosed, cb.currentState(cfg, later))
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	cfg := CircuitBreaker{FailureRatio: 1, MinRequests: 1, CoolDown: time.Second, HalfOpenProbes: 2}
+	cb := circuitBreaker{}
+	now := time.Now()
+
+	cb.allow(cfg, now)
+	cb.record(cfg, false, circuitFailed, now)
+	assert.Equal(t, CircuitOpen, cb.currentState(cfg, now))
+
+	// a failed probe reopens the circuit
+	now = now.Add(time.Second)
+	probe, err := cb.allow(cfg, now)
+	assert.True(t, probe)
+	assert.Nil(t, err)
+	cb.record(cfg, probe, circuitFailed, now)
+	assert.Equal(t, CircuitOpen, cb.currentState(cfg, now))
+
+	// only HalfOpenProbes are let through at once
+	now = now.Add(time.Second)
+	p1, _ := cb.allow(cfg, now)
+	p2, _ := cb.allow(cfg, now)
+	_, err = cb.allow(cfg, now)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+	// an abandoned probe frees its slot
+	cb.record(cfg, p2, circuitAbandoned, now)
+	p3, err := cb.allow(cfg, now)
+	assert.Nil(t, err)
+
+	cb.record(cfg, p1, circuitSucceeded, now)
+	assert.Equal(t, CircuitHalfOpen, cb.currentState(cfg, now))
+	cb.record(cfg, p3, circuitSucceeded, now)
+	assert.Equal(t, CircuitClosed, cb.currentState(cfg, now))
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/aychttp"
+)
+
+// StatusClassifier reports whether a response with the given status code should be retried.
+//
+// The built-in policies can each be built with a custom StatusClassifier, e.g.
+//
+//	retryable := ratelimit.DefaultRetryableStatus.With(408, 502, 504)
+//	policy := retryable.IdiomaticRetryAfter(ratelimit.Backoff{})
+type StatusClassifier func(status int) bool
+
+// DefaultRetryableStatus retries 429, 500, and 503 status codes. It's the StatusClassifier used
+// by ExponentialBackoff, RetryAfterDurationInHeader, RetryAfterTimeInHeader, IdiomaticRetryAfter,
+// their `With` variants, and NewPolicy. Reassigning it changes the status codes they retry, so it
+// should only be done before any requests are made.
+var DefaultRetryableStatus StatusClassifier = aychttp.IsRetryableStatus
+
+// defaultRetryableStatus reads DefaultRetryableStatus on every call, so that the built-in policies
+// see it reassigned even if they were built beforehand.
+func defaultRetryableStatus(status int) bool {
+	return DefaultRetryableStatus(status)
+}
+
+// RetryableStatuses returns a StatusClassifier that retries exactly the given status codes.
+func RetryableStatuses(statuses ...int) StatusClassifier {
+	set := make(map[int]bool, len(statuses))
+	for _, status := range statuses {
+		set[status] = true
+	}
+	return func(status int) bool {
+		return set[status]
+	}
+}
+
+// With returns a StatusClassifier that retries the given status codes, in addition to those
+// retried by `c`.
+func (c StatusClassifier) With(statuses ...int) StatusClassifier {
+	also := RetryableStatuses(statuses...)
+	return func(status int) bool {
+		return c(status) || also(status)
+	}
+}
+
+// ExponentialBackoff is like ExponentialBackoffWith, but retries the status codes classified as
+// retryable by `c`.
+func (c StatusClassifier) ExponentialBackoff(b Backoff) RetryAfterPolicy {
+	return func(resp *http.Response, prevResps ...*http.Response) (bool, time.Time) {
+		return exponentialBackoff(c, b, resp, prevResps)
+	}
+}
+
+// RetryAfterDurationInHeader is like the package level RetryAfterDurationInHeader, but retries the
+// status codes classified as retryable by `c`.
+func (c StatusClassifier) RetryAfterDurationInHeader() RetryAfterPolicy {
+	return func(resp *http.Response, prevResps ...*http.Response) (bool, time.Time) {
+		return retryAfterDurationInHeader(c, resp)
+	}
+}
+
+// RetryAfterTimeInHeader is like the package level RetryAfterTimeInHeader, but retries the status
+// codes classified as retryable by `c`.
+func (c StatusClassifier) RetryAfterTimeInHeader() RetryAfterPolicy {
+	return func(resp *http.Response, prevResps ...*http.Response) (bool, time.Time) {
+		return retryAfterTimeInHeader(c, resp)
+	}
+}
+
+// IdiomaticRetryAfter is like IdiomaticRetryAfterWith, but retries the status codes classified as
+// retryable by `c`.
+func (c StatusClassifier) IdiomaticRetryAfter(b Backoff) RetryAfterPolicy {
+	return func(resp *http.Response, prevResps ...*http.Response) (bool, time.Time) {
+		return idiomaticRetryAfter(c, b, resp, prevResps)
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/testutils"
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultRetryableStatus(t *testing.T) {
+	for _, status := range []int{429, 500, 503} {
+		assert.True(t, DefaultRetryableStatus(status), status)
+	}
+	for _, status := range []int{200, 404, 408, 502, 504} {
+		assert.False(t, DefaultRetryableStatus(status), status)
+	}
+}
+
+func TestReassigningDefaultRetryableStatus(t *testing.T) {
+	policy := IdiomaticRetryAfterWith(Backoff{})
+	builder := NewPolicy().Build()
+
+	defer func(c StatusClassifier) { DefaultRetryableStatus = c }(DefaultRetryableStatus)
+	DefaultRetryableStatus = DefaultRetryableStatus.With(502)
+
+	resp := testutils.StubResponse(502, "")
+	for _, p := range []RetryAfterPolicy{
+		ExponentialBackoff, RetryAfterDurationInHeader, IdiomaticRetryAfter, policy, builder,
+	} {
+		retry, _ := p(resp)
+		assert.True(t, retry)
+	}
+}
+
+func TestRetryableStatuses(t *testing.T) {
+	c := RetryableStatuses(420, 509)
+	assert.True(t, c(420))
+	assert.True(t, c(509))
+	assert.False(t, c(429))
+
+	c = DefaultRetryableStatus.With(408, 502)
+	assert.True(t, c(408))
+	assert.True(t, c(502))
+	assert.True(t, c(429))
+	assert.False(t, c(504))
+}
+
+func TestClassifiedPolicies(t *testing.T) {
+	c := RetryableStatuses(502)
+	now := time.Now()
+
+	tyme.FreezeTimeAt(now, func() {
+		retry, after := c.ExponentialBackoff(Backoff{})(testutils.StubResponse(502, ""))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(1*time.Second), after)
+
+		retry, _ = c.ExponentialBackoff(Backoff{})(testutils.StubResponse(429, ""))
+		assert.False(t, retry)
+
+		retry, after = c.RetryAfterDurationInHeader()(testutils.StubResponse(502, "",
+			"Retry-After", "10"))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(10*time.Second), after)
+
+		retry, after = c.RetryAfterTimeInHeader()(testutils.StubResponse(502, "",
+			"Retry-After", "Wed, 21 Oct 2015 07:28:00 GMT"))
+		assert.True(t, retry)
+		assert.Equal(t, time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC), after)
+
+		retry, after = c.IdiomaticRetryAfter(Backoff{})(testutils.StubResponse(503, "",
+			"Retry-After", "10"))
+		assert.False(t, retry)
+		assert.EqualValues(t, now.Add(10*time.Second), after)
+	})
+}
@@ -27,7 +27,12 @@ type Client struct {
 	// before retrying. If RetryAfterPolicy is nil, the Client will use IdiomaticRetryAfter.
 	RetryAfterPolicy RetryAfterPolicy
 
+	// Options configure retries, and the client side rate limits enforced on top of the server's.
+	// See Options.
+	Options
+
 	limiter RateLimiter
+	sem     semaphore
 }
 
 func (c *Client) CloseIdleConnections() {
@@ -35,11 +40,18 @@ func (c *Client) CloseIdleConnections() {
 }
 
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
-	policy := c.RetryAfterPolicy
-	if policy == nil {
-		policy = IdiomaticRetryAfter
-	}
-	return c.limiter.do(req, &c.C, policy)
+	c.limiter.setBudget(c.Limit, c.Adaptive)
+
+	opts := c.doOptions(c.RetryAfterPolicy)
+	opts.sem = &c.sem
+	opts.key = requestHost(req)
+	return c.limiter.do(req, c.C.Do, opts)
+}
+
+// Rate returns the rate, in requests per second, currently enforced by the Client. With Adaptive
+// enabled, this is the rate learned so far. Zero means no limit.
+func (c *Client) Rate() float64 {
+	return c.limiter.Rate()
 }
 
 func (c *Client) Get(url string) (resp *http.Response, err error) {
@@ -2,9 +2,16 @@ package ratelimit
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -97,6 +104,664 @@ func TestHonorsRateLimits(t *testing.T) {
 	assert.Equal(t, howManyTimesWasSleepCalled, 1)
 }
 
+func TestDoReturnsWhenContextIsCancelled(t *testing.T) {
+	c := clientWithPolicy(RetryAfterDurationInHeader)
+
+	requests := 0
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		requests += 1
+		return testutils.StubResponse(429, "rate limited!", "Retry-After", "3600"), nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://server.io/endpoint", nil)
+
+	start := time.Now()
+	resp, err := c.Do(req)
+	assert.Nil(t, resp)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 1*time.Minute)
+	assert.Equal(t, 1, requests)
+}
+
+func TestDoFailsFastWhenRetryAfterExceedsDeadline(t *testing.T) {
+	c := clientWithPolicy(RetryAfterDurationInHeader)
+
+	requests := 0
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		requests += 1
+		return testutils.StubResponse(429, "rate limited!", "Retry-After", "120"), nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://server.io/endpoint", nil)
+
+	start := time.Now()
+	resp, err := c.Do(req)
+	assert.Nil(t, resp)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, 1, requests)
+
+	var deadlineErr *RetryAfterDeadlineError
+	if assert.ErrorAs(t, err, &deadlineErr) {
+		assert.WithinDuration(t, start.Add(120*time.Second), deadlineErr.RetryAfter, 5*time.Second)
+		deadline, _ := ctx.Deadline()
+		assert.Equal(t, deadline, deadlineErr.Deadline)
+	}
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClientLimit(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+	c.Limit = Limit{Rate: 1, Burst: 1}
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		return testutils.StubResponse(200, "success"), nil
+	})
+
+	var sleeps []time.Duration
+	sleep := func(d time.Duration) {
+		if d > 0 {
+			sleeps = append(sleeps, d)
+		}
+	}
+
+	tyme.FreezeTimeAt(time.Now(), func() {
+		tyme.StubSleep(sleep, func() {
+			c.Get("https://server.io/endpoint")
+			c.Get("https://server.io/endpoint")
+		})
+	})
+
+	assert.Equal(t, []time.Duration{1 * time.Second}, sleeps)
+}
+
+func TestPacesConcurrentRequestsToAdvertisedQuota(t *testing.T) {
+	c := clientWithPolicy(RateLimitHeaders)
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		return testutils.StubResponse(200, "success",
+			"RateLimit", "limit=100, remaining=10, reset=5"), nil
+	})
+
+	var lock sync.Mutex
+	var sleeps []time.Duration
+	sleep := func(d time.Duration) {
+		if d > 0 {
+			lock.Lock()
+			sleeps = append(sleeps, d)
+			lock.Unlock()
+		}
+	}
+
+	tyme.FreezeTimeAt(time.Now(), func() {
+		tyme.StubSleep(sleep, func() {
+			resp, err := c.Get("https://server.io/endpoint")
+			if assert.Nil(t, err) {
+				resp.Body.Close()
+			}
+
+			wg := sync.WaitGroup{}
+			for i := 0; i < 6; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp, err := c.Get("https://server.io/endpoint")
+					if assert.Nil(t, err) {
+						resp.Body.Close()
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	})
+
+	// 10 requests remaining over 5s allows one every 500ms, and the first is already available.
+	sort.Slice(sleeps, func(i, j int) bool { return sleeps[i] < sleeps[j] })
+	assert.Equal(t, []time.Duration{
+		500 * time.Millisecond, 1 * time.Second, 1500 * time.Millisecond,
+		2 * time.Second, 2500 * time.Millisecond,
+	}, sleeps)
+}
+
+func TestMaxRetries(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+	c.MaxRetries = 2
+
+	requests := 0
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		requests += 1
+		return testutils.StubResponse(503, "unavailable"), nil
+	})
+
+	resp, err := c.Get("https://server.io/endpoint")
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 503, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "unavailable", string(body))
+
+	var exhausted *RetriesExhaustedError
+	if assert.ErrorAs(t, err, &exhausted) {
+		assert.Equal(t, []int{503, 503, 503}, attemptStatuses(exhausted.Attempts))
+	}
+}
+
+func TestMaxTotalWait(t *testing.T) {
+	c := clientWithPolicy(ExponentialBackoff)
+	c.MaxTotalWait = 5 * time.Second
+
+	requests := 0
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		requests += 1
+		return testutils.StubResponse(429, "rate limited"), nil
+	})
+
+	var resp *http.Response
+	var err error
+
+	tyme.FreezeTimeAt(time.Now(), func() {
+		tyme.StubSleep(func(time.Duration) {}, func() {
+			resp, err = c.Get("https://server.io/endpoint")
+		})
+	})
+
+	assert.Equal(t, 429, resp.StatusCode)
+
+	var exhausted *RetriesExhaustedError
+	if assert.ErrorAs(t, err, &exhausted) {
+		// waits of 1s and 2s fit within 5s, but the next wait of 4s does not.
+		assert.Equal(t, []int{429, 429, 429}, attemptStatuses(exhausted.Attempts))
+		assert.Equal(t, []time.Duration{0, 1 * time.Second, 2 * time.Second},
+			attemptWaits(exhausted.Attempts))
+	}
+	assert.Equal(t, 3, requests)
+}
+
+func TestRetriesTransientErrors(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+	c.RetryErrorPolicy = retryErrorsImmedietly
+	b := testutils.Repeater(2)
+
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "the body", bod(req))
+		if <-b {
+			return nil, syscall.ECONNRESET
+		}
+		return testutils.StubResponse(200, "success"), nil
+	})
+
+	req, _ := http.NewRequest("PUT", "https://server.io/endpoint", toReader("the body"))
+	req.Header.Set("Content-Type", "text")
+
+	resp, err := c.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestDoesNotRetryPermanentErrors(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+	c.RetryErrorPolicy = retryErrorsImmedietly
+
+	requests := 0
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		requests += 1
+		return nil, errors.New("nope")
+	})
+
+	_, err := c.Get("https://server.io/endpoint")
+	assert.Contains(t, err.Error(), "nope")
+	assert.Equal(t, 1, requests)
+}
+
+func TestTransientErrorsExhaustRetries(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+	c.RetryErrorPolicy = retryErrorsImmedietly
+	c.MaxRetries = 1
+
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		return nil, io.ErrUnexpectedEOF
+	})
+
+	resp, err := c.Get("https://server.io/endpoint")
+	assert.Nil(t, resp)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	var exhausted *RetriesExhaustedError
+	if assert.ErrorAs(t, err, &exhausted) {
+		assert.Len(t, exhausted.Attempts, 2)
+	}
+}
+
+func TestNonIdempotentRetries(t *testing.T) {
+	cases := []struct {
+		name      string
+		status    int
+		err       error
+		key       string
+		retried   bool
+		anyMethod bool
+	}{
+		{name: "429", status: 429, retried: true},
+		{name: "503", status: 503, retried: true},
+		{name: "500", status: 500, retried: false},
+		{name: "500 with key", status: 500, key: "abc", retried: true},
+		{name: "500 with RetryNonIdempotent", status: 500, anyMethod: true, retried: true},
+		{name: "reset", err: syscall.ECONNRESET, retried: false},
+		{name: "reset with key", err: syscall.ECONNRESET, key: "abc", retried: true},
+		{name: "refused", err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, retried: true},
+	}
+
+	for _, tc := range cases {
+		c := clientWithPolicy(retryImmedietly)
+		c.RetryErrorPolicy = retryErrorsImmedietly
+		c.RetryNonIdempotent = tc.anyMethod
+		b := testutils.Repeater(1)
+
+		requests := 0
+		c.stubRequest(func(req *http.Request) (*http.Response, error) {
+			requests += 1
+			if <-b {
+				if tc.err != nil {
+					return nil, tc.err
+				}
+				return testutils.StubResponse(tc.status, ""), nil
+			}
+			return testutils.StubResponse(200, ""), nil
+		})
+
+		req, _ := http.NewRequest("PATCH", "https://server.io/endpoint", nil)
+		if tc.key != "" {
+			req.Header.Set(IdempotencyKeyHeader, tc.key)
+		}
+		c.Do(req)
+
+		if tc.retried {
+			assert.Equal(t, 2, requests, tc.name)
+		} else {
+			assert.Equal(t, 1, requests, tc.name)
+		}
+	}
+}
+
+func TestAutoIdempotencyKey(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+	c.AutoIdempotencyKey = true
+	b := testutils.Repeater(1)
+
+	var keys []string
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		keys = append(keys, req.Header.Get(IdempotencyKeyHeader))
+		assert.Equal(t, "the body", bod(req))
+		if <-b {
+			return testutils.StubResponse(500, ""), nil
+		}
+		return testutils.StubResponse(200, ""), nil
+	})
+
+	req, _ := http.NewRequest("POST", "https://server.io/endpoint", toReader("the body"))
+	req.Header.Set("Content-Type", "text")
+
+	resp, err := c.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	// the same key is sent with every attempt, and the caller's request is left alone
+	assert.Len(t, keys, 2)
+	assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	assert.Empty(t, req.Header.Get(IdempotencyKeyHeader))
+}
+
+func TestBodyWithoutGetBodyIsNotReplayed(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+
+	requests := 0
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		requests += 1
+		assert.Equal(t, "the body", bod(req))
+		return testutils.StubResponse(429, "rate limited"), nil
+	})
+
+	req, _ := http.NewRequest("PUT", "https://server.io/endpoint", onlyReader{toReader("the body")})
+
+	resp, err := c.Do(req)
+	assert.ErrorIs(t, err, ErrBodyNotReplayable)
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, 1, requests)
+}
+
+func TestBuffersBodyWithoutGetBody(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		c := clientWithPolicy(retryImmedietly)
+		c.MaxBufferedBodySize = 1024
+		c.BufferBodiesToDisk = toDisk
+		b := testutils.Repeater(2)
+
+		c.stubRequest(func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "the body", bod(req))
+			if <-b {
+				return testutils.StubResponse(429, "rate limited"), nil
+			}
+			return testutils.StubResponse(200, "success"), nil
+		})
+
+		req, _ := http.NewRequest("PUT", "https://server.io/endpoint", onlyReader{toReader("the body")})
+
+		resp, err := c.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Nil(t, req.GetBody) // the caller's request is left alone
+	}
+}
+
+func TestDoesNotBufferLargeBodies(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+	c.MaxBufferedBodySize = 4
+
+	requests := 0
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		requests += 1
+		assert.Equal(t, "the body", bod(req))
+		return testutils.StubResponse(429, "rate limited"), nil
+	})
+
+	req, _ := http.NewRequest("PUT", "https://server.io/endpoint", onlyReader{toReader("the body")})
+
+	_, err := c.Do(req)
+	assert.ErrorIs(t, err, ErrBodyNotReplayable)
+	assert.Equal(t, 1, requests)
+}
+
+func TestAttemptPolicy(t *testing.T) {
+	var seen [][]Attempt
+	c := &Client{Options: Options{
+		AttemptPolicy: func(resp *http.Response, prevAttempts []Attempt) (bool, time.Time) {
+			seen = append(seen, prevAttempts)
+			return resp.StatusCode != 200, time.Time{}
+		},
+		RetryErrorPolicy: retryErrorsImmedietly,
+	}}
+	b := testutils.Repeater(2)
+	failed := false
+
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		if !failed {
+			failed = true
+			return nil, io.ErrUnexpectedEOF
+		}
+		if <-b {
+			return testutils.StubResponse(429, "", "Retry-After", "0"), nil
+		}
+		return testutils.StubResponse(200, "success"), nil
+	})
+
+	resp, err := c.Get("https://server.io/endpoint")
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	if assert.Len(t, seen, 3) {
+		assert.Equal(t, []int{0, 429, 429}, attemptStatuses(seen[2]))
+		assert.ErrorIs(t, seen[2][0].Err, io.ErrUnexpectedEOF)
+		assert.Equal(t, "0", seen[2][1].Header.Get("Retry-After"))
+	}
+}
+
+func TestRetryAfterPolicyAdapter(t *testing.T) {
+	var prevStatuses []int
+	var legacy RetryAfterPolicy = func(resp *http.Response, prevResps ...*http.Response) (bool, time.Time) {
+		for _, r := range prevResps {
+			prevStatuses = append(prevStatuses, r.StatusCode)
+			assert.Equal(t, "10", r.Header.Get("Retry-After"))
+		}
+		return false, time.Time{}
+	}
+	policy := legacy.AttemptPolicy()
+
+	policy(testutils.StubResponse(200, ""), []Attempt{
+		{Err: io.EOF},
+		{StatusCode: 429, Header: http.Header{"Retry-After": {"10"}}},
+		{StatusCode: 503, Header: http.Header{"Retry-After": {"10"}}},
+	})
+	assert.Equal(t, []int{429, 503}, prevStatuses)
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+	c.MaxConcurrency = 2
+
+	var lock sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		lock.Lock()
+		inFlight += 1
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		lock.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		lock.Lock()
+		inFlight -= 1
+		lock.Unlock()
+		return testutils.StubResponse(200, "success"), nil
+	})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.Get("https://server.io/endpoint")
+			assert.Nil(t, err)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 2, maxInFlight)
+}
+
+func TestMaxConcurrencyHoldsUntilBodyIsClosed(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+	c.MaxConcurrency = 1
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		return testutils.StubResponse(200, "success"), nil
+	})
+
+	resp, err := c.Get("https://server.io/endpoint")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://server.io/endpoint", nil)
+	_, err = c.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	resp.Body.Close()
+	resp, err = c.Get("https://server.io/endpoint")
+	assert.Nil(t, err)
+	resp.Body.Close()
+}
+
+func TestMaxConcurrencyReleasedWhenRetriesExhausted(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+	c.MaxConcurrency = 1
+	c.MaxRetries = 1
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		return testutils.StubResponse(503, "unavailable"), nil
+	})
+
+	// the caller ignores the response, as http.Client allows alongside an error
+	_, err := c.Get("https://server.io/endpoint")
+	var exhausted *RetriesExhaustedError
+	assert.ErrorAs(t, err, &exhausted)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://server.io/endpoint", nil)
+	resp, err := c.Do(req)
+	assert.ErrorAs(t, err, &exhausted)
+
+	// the response is still readable, but must be closed
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "unavailable", string(body))
+	resp.Body.Close()
+}
+
+func TestSwitchingProtocolsBodyStaysWritable(t *testing.T) {
+	for _, maxConcurrency := range []int{0, 1} {
+		c := clientWithPolicy(retryImmedietly)
+		c.MaxConcurrency = maxConcurrency
+		c.stubRequest(func(req *http.Request) (*http.Response, error) {
+			resp := testutils.StubResponse(101, "")
+			resp.Body = readWriteCloser{resp.Body}
+			return resp, nil
+		})
+
+		resp, err := c.Get("https://server.io/socket")
+		assert.Nil(t, err)
+		_, ok := resp.Body.(io.ReadWriteCloser)
+		assert.True(t, ok, "MaxConcurrency = %d", maxConcurrency)
+		resp.Body.Close()
+	}
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	c := clientWithPolicy(retryImmedietly)
+	c.Adaptive = AdaptiveLimit{InitialRate: 10}
+	b := testutils.Repeater(1)
+
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		if <-b {
+			return testutils.StubResponse(429, "rate limited"), nil
+		}
+		return testutils.StubResponse(200, "success"), nil
+	})
+
+	var resp *http.Response
+	var err error
+	tyme.FreezeTimeAt(time.Now(), func() {
+		tyme.StubSleep(func(time.Duration) {}, func() {
+			resp, err = c.Get("https://server.io/endpoint")
+		})
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.InDelta(t, 5.2, c.Rate(), 1e-9) // halved by the 429, then +1/5 for the 200
+}
+
+func TestHooks(t *testing.T) {
+	var events []string
+	record := func(name string) func(HookEvent) {
+		return func(ev HookEvent) {
+			assert.Equal(t, "server.io", ev.Key)
+			assert.Equal(t, "https://server.io/endpoint", ev.Request.URL.String())
+			events = append(events, fmt.Sprintf("%s #%d status=%d retry=%t wait=%s err=%v",
+				name, ev.Attempt, ev.StatusCode, ev.Retry, ev.Wait, ev.Err))
+		}
+	}
+
+	c := clientWithPolicy(RetryAfterDurationInHeader)
+	c.MaxRetries = 1
+	c.Hooks = Hooks{
+		OnWait:           record("wait"),
+		OnAttemptStart:   record("start"),
+		OnAttemptEnd:     record("end"),
+		OnRetryScheduled: record("retry"),
+		OnGiveUp:         record("give up"),
+	}
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		return testutils.StubResponse(429, "", "Retry-After", "10"), nil
+	})
+
+	var err error
+	tyme.FreezeTimeAt(time.Now(), func() {
+		tyme.StubSleep(func(time.Duration) {}, func() {
+			_, err = c.Get("https://server.io/endpoint")
+		})
+	})
+
+	assert.Equal(t, []string{
+		"start #1 status=0 retry=false wait=0s err=<nil>",
+		"end #1 status=429 retry=true wait=0s err=<nil>",
+		"retry #1 status=429 retry=true wait=10s err=<nil>",
+		"wait #2 status=0 retry=false wait=10s err=<nil>",
+		"start #2 status=0 retry=false wait=10s err=<nil>",
+		"end #2 status=429 retry=true wait=10s err=<nil>",
+		"give up #2 status=429 retry=false wait=0s err=" + err.Error(),
+	}, events)
+}
+
+func TestLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	c := clientWithPolicy(retryImmedietly)
+	c.Logger = logger
+	b := testutils.Repeater(1)
+
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		if <-b {
+			return testutils.StubResponse(429, "", "Retry-After", "soon"), nil
+		}
+		return testutils.StubResponse(200, ""), nil
+	})
+
+	tyme.FreezeTimeAt(time.Now(), func() {
+		_, err := c.Get("https://server.io/endpoint")
+		assert.Nil(t, err)
+	})
+
+	// retryImmedietly never reads Retry-After, so there's nothing to report about it
+	if assert.Len(t, logger.records, 2) {
+		assert.Equal(t, []interface{}{"ratelimit: attempt", "key", "server.io", "attempt", 1,
+			"status", 429, "duration", time.Duration(0), "retry", true, "retry_after", "soon"},
+			logger.records[0])
+		assert.Equal(t, []interface{}{"ratelimit: attempt", "key", "server.io", "attempt", 2,
+			"status", 200, "duration", time.Duration(0), "retry", false},
+			logger.records[1])
+	}
+}
+
+func TestLoggerReportsUnparseableHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		policy RetryAfterPolicy
+		header []string
+	}{
+		{RetryAfterDurationInHeader, []string{"Retry-After", "soon"}},
+		{IdiomaticRetryAfter, []string{"Retry-After", "soon"}},
+		{NewPolicy().HonorRetryAfter().Build(), []string{"Retry-After", "soon"}},
+		{XRateLimitHeaders, []string{"X-RateLimit-Remaining", "none"}},
+		{XRateLimitHeaders, []string{"X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "later"}},
+		{RateLimitHeaders, []string{"RateLimit", "limit=100, remaining=lots, reset=30"}},
+		{RateLimitHeaders, []string{"RateLimit-Policy", `"default";q=100;w=a minute`}},
+	} {
+		logger := &recordingLogger{}
+		c := clientWithPolicy(tc.policy)
+		c.Logger = logger
+		c.stubRequest(func(req *http.Request) (*http.Response, error) {
+			return testutils.StubResponse(200, "", tc.header...), nil
+		})
+
+		tyme.FreezeTimeAt(time.Now(), func() {
+			_, err := c.Get("https://server.io/endpoint")
+			assert.Nil(t, err)
+		})
+
+		name, value := tc.header[len(tc.header)-2], tc.header[len(tc.header)-1]
+		if assert.Len(t, logger.records, 2, name) {
+			record := logger.records[1]
+			assert.Equal(t, []interface{}{"ratelimit: ignoring unparseable header", "key",
+				"server.io", "attempt", 1, "header", name, "value", value}, record[:9])
+			assert.Equal(t, "error", record[9])
+			assert.Error(t, record[10].(error))
+		}
+	}
+}
+
 // ################################
 // ######### Helper Shit ##########
 // ################################
@@ -113,6 +778,11 @@ func retryImmedietly(resp *http.Response, _ ...*http.Response) (bool, time.Time)
 	return aychttp.IsRetryable(resp), time.Time{}
 }
 
+// Useful to keep the tests snappy
+func retryErrorsImmedietly(err error, _ ...error) (bool, time.Time) {
+	return IsTransientError(err), time.Time{}
+}
+
 // StubRequest will stub the internal http.Client's transport to use the given function.
 // Useful for stubbing responses used by the client.
 func (c *Client) stubRequest(rtf func(r *http.Request) (*http.Response, error)) {
@@ -135,3 +805,39 @@ func bod(req *http.Request) string {
 func toReader(s string) io.Reader {
 	return strings.NewReader(s)
 }
+
+// onlyReader hides any other methods of the underlying reader, so that http.NewRequest can't set
+// GetBody.
+type onlyReader struct {
+	io.Reader
+}
+
+func attemptStatuses(attempts []Attempt) (statuses []int) {
+	for _, a := range attempts {
+		statuses = append(statuses, a.StatusCode)
+	}
+	return statuses
+}
+
+func attemptWaits(attempts []Attempt) (waits []time.Duration) {
+	for _, a := range attempts {
+		waits = append(waits, a.Wait)
+	}
+	return waits
+}
+
+type recordingLogger struct {
+	records [][]interface{}
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) {
+	l.records = append(l.records, append([]interface{}{msg}, args...))
+}
+
+type readWriteCloser struct {
+	io.ReadCloser
+}
+
+func (readWriteCloser) Write(p []byte) (int, error) {
+	return len(p), nil
+}
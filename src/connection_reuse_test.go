@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetriesReuseConnections(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(strings.Repeat("slow down! ", 1000)))
+			return
+		}
+		w.Write([]byte("success"))
+	}))
+	defer server.Close()
+
+	var dials int64
+	dialer := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt64(&dials, 1)
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	defer transport.CloseIdleConnections()
+
+	c := clientWithPolicy(retryImmedietly)
+	c.C.Transport = transport
+
+	resp, err := c.Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.EqualValues(t, 3, atomic.LoadInt32(&requests))
+	assert.EqualValues(t, 1, atomic.LoadInt64(&dials))
+}
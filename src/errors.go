@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrBodyNotReplayable is returned alongside the last response when a request warranted a retry,
+// but its body had already been consumed, and couldn't be replayed. Bodies can be replayed when
+// the request has a GetBody (http.NewRequest sets it for *bytes.Buffer, *bytes.Reader, and
+// *strings.Reader bodies), or when they were buffered (see MaxBufferedBodySize).
+var ErrBodyNotReplayable = errors.New("ratelimit: request body can't be replayed for a retry")
+
+// ErrCircuitOpen is matched (via errors.Is) by every *CircuitOpenError.
+var ErrCircuitOpen = errors.New("ratelimit: circuit open")
+
+// CircuitOpenError is returned by MultiHostClient when a host's circuit breaker is open (or is
+// half-open, and already probing), so the request was failed without being sent. See
+// CircuitBreaker.
+//
+// CircuitOpenError unwraps to ErrCircuitOpen.
+type CircuitOpenError struct {
+
+	// Host is the host whose circuit is open (or the key, if MultiHostClient.KeyFunc is set).
+	Host string
+
+	// State is the state of the circuit, either CircuitOpen or CircuitHalfOpen.
+	State CircuitState
+
+	// RetryAt is when the circuit will let probe requests through, or the zero time if it's
+	// already half-open.
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.RetryAt.IsZero() {
+		return fmt.Sprintf("ratelimit: circuit %s for %q", e.State, e.Host)
+	}
+	return fmt.Sprintf("ratelimit: circuit %s for %q until %s",
+		e.State, e.Host, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// RetryAfterDeadlineError is returned when honoring a rate limit would require waiting past the
+// request's context deadline. Rather than sleeping only to fail, the request is abandoned
+// immediately.
+//
+// RetryAfterDeadlineError unwraps to context.DeadlineExceeded, so callers checking for
+// `errors.Is(err, context.DeadlineExceeded)` will still catch it.
+type RetryAfterDeadlineError struct {
+
+	// RetryAfter is the earliest time at which the request may be retried.
+	RetryAfter time.Time
+
+	// Deadline is the deadline of the request's context.
+	Deadline time.Time
+}
+
+func (e *RetryAfterDeadlineError) Error() string {
+	return fmt.Sprintf("ratelimit: retry after %s exceeds context deadline %s",
+		e.RetryAfter.Format(time.RFC3339), e.Deadline.Format(time.RFC3339))
+}
+
+func (e *RetryAfterDeadlineError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// RetriesExhaustedError is returned alongside the last response when a request still warranted a
+// retry, but retrying would exceed MaxRetries or MaxTotalWait. If the last attempt failed without
+// a response, RetriesExhaustedError unwraps to its error.
+//
+// Unlike http.Client, the last response is returned open, so that it can be inspected. Callers
+// must close its body (if it's non-nil), or the connection can't be reused.
+type RetriesExhaustedError struct {
+
+	// Attempts lists every attempt made, in order.
+	Attempts []Attempt
+}
+
+func (e *RetriesExhaustedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ratelimit: retries exhausted after %d attempts:", len(e.Attempts))
+	for i, a := range e.Attempts {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		if a.Err != nil {
+			fmt.Fprintf(&b, " %q (waited %s)", a.Err, a.Wait)
+		} else {
+			fmt.Fprintf(&b, " %d (waited %s)", a.StatusCode, a.Wait)
+		}
+	}
+	return b.String()
+}
+
+func (e *RetriesExhaustedError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1].Err
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"net/http"
+	"time"
+)
+
+// Hooks are callbacks invoked as a request makes its way through the retry loop, so that
+// applications can wire in logging, metrics, or tracing. Any hook may be nil. Hooks are called
+// synchronously from the goroutine making the request, so they should be quick.
+type Hooks struct {
+
+	// OnRequestStart is called once per request, before its first attempt. Attempt is 0.
+	OnRequestStart func(HookEvent)
+
+	// OnRequestEnd is called once per request, with the response (or error) returned to the
+	// caller. Attempt is the number of attempts made.
+	OnRequestEnd func(HookEvent)
+
+	// OnWait is called after a request waited on rate limits before an attempt. Wait is how long
+	// it waited. OnWait isn't called if the attempt didn't have to wait.
+	OnWait func(HookEvent)
+
+	// OnAttemptStart is called immediately before each attempt is sent. Wait is how long the
+	// attempt waited on rate limits. OnAttemptStart may modify Request's headers (e.g. to
+	// propagate trace context). Request is a clone, so this won't affect the caller's request.
+	OnAttemptStart func(HookEvent)
+
+	// OnAttemptEnd is called once each attempt has a response (or failed). StatusCode, Header,
+	// or Err describe the outcome, Duration is how long it took, and Retry is the policy's
+	// decision.
+	OnAttemptEnd func(HookEvent)
+
+	// OnRetryScheduled is called once a retry has been decided on. Wait is how long until the
+	// server allows the next attempt (e.g. via Retry-After). Client side budgets may add to it.
+	OnRetryScheduled func(HookEvent)
+
+	// OnGiveUp is called when a request fails with an error, including when retries are
+	// exhausted. Err is the error returned to the caller. If there was a last response, its
+	// status is in StatusCode. Attempt is the number of attempts made, which may be 0 (e.g. when
+	// the circuit breaker is open).
+	OnGiveUp func(HookEvent)
+}
+
+// HookEvent describes an event passed to Hooks. Fields which don't apply to a given hook are left
+// as their zero value.
+type HookEvent struct {
+
+	// Request is the request being sent. It's the same *http.Request for every event belonging to
+	// a single call to Do (or RoundTrip), so it can be used to correlate them.
+	Request *http.Request
+
+	// Key is the host the request was sent to, or the key returned by KeyFunc.
+	Key string
+
+	// Attempt is the attempt number, starting at 1.
+	Attempt int
+
+	// StatusCode is the status code of the attempt's response, or 0 if there wasn't one.
+	StatusCode int
+
+	// Header is the attempt's response headers, or nil if there wasn't a response.
+	Header http.Header
+
+	// Err is the error the attempt (or the request) failed with, if any.
+	Err error
+
+	// Retry is whether the attempt will be retried.
+	Retry bool
+
+	// Wait is time spent (or to be spent) waiting, as described by each hook.
+	Wait time.Duration
+
+	// Duration is how long the attempt took, from sending the request until the response headers
+	// (or an error) were received.
+	Duration time.Duration
+}
+
+// JoinHooks returns Hooks which call each of `hooks` in turn, e.g. to both collect metrics and
+// trace requests:
+//
+//	client.Hooks = ratelimit.JoinHooks(collector.Hooks(), tracer.Hooks())
+func JoinHooks(hooks ...Hooks) Hooks {
+	join := func(get func(Hooks) func(HookEvent)) func(HookEvent) {
+		var fns []func(HookEvent)
+		for _, h := range hooks {
+			if fn := get(h); fn != nil {
+				fns = append(fns, fn)
+			}
+		}
+		switch len(fns) {
+		case 0:
+			return nil
+		case 1:
+			return fns[0]
+		}
+		return func(ev HookEvent) {
+			for _, fn := range fns {
+				fn(ev)
+			}
+		}
+	}
+
+	return Hooks{
+		OnRequestStart:   join(func(h Hooks) func(HookEvent) { return h.OnRequestStart }),
+		OnRequestEnd:     join(func(h Hooks) func(HookEvent) { return h.OnRequestEnd }),
+		OnWait:           join(func(h Hooks) func(HookEvent) { return h.OnWait }),
+		OnAttemptStart:   join(func(h Hooks) func(HookEvent) { return h.OnAttemptStart }),
+		OnAttemptEnd:     join(func(h Hooks) func(HookEvent) { return h.OnAttemptEnd }),
+		OnRetryScheduled: join(func(h Hooks) func(HookEvent) { return h.OnRetryScheduled }),
+		OnGiveUp:         join(func(h Hooks) func(HookEvent) { return h.OnGiveUp }),
+	}
+}
+
+// ################################
+// ##### private hooks stuff ######
+// ################################
+
+func call(hook func(HookEvent), ev HookEvent) {
+	if hook != nil {
+		hook(ev)
+	}
+}
@@ -0,0 +1,28 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinHooks(t *testing.T) {
+	var calls []string
+	record := func(name string) func(HookEvent) {
+		return func(HookEvent) { calls = append(calls, name) }
+	}
+
+	hooks := JoinHooks(
+		Hooks{OnWait: record("first wait"), OnGiveUp: record("first give up")},
+		Hooks{},
+		Hooks{OnWait: record("second wait"), OnAttemptEnd: record("second attempt end")},
+	)
+	assert.Nil(t, hooks.OnRequestStart)
+	assert.Nil(t, hooks.OnRetryScheduled)
+
+	hooks.OnWait(HookEvent{})
+	hooks.OnAttemptEnd(HookEvent{})
+	hooks.OnGiveUp(HookEvent{})
+	assert.Equal(t, []string{"first wait", "second wait", "second attempt end", "first give up"},
+		calls)
+}
@@ -0,0 +1,260 @@
+package ratelimit
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+)
+
+// HostState describes the state tracked for a single host (or key), as listed by
+// MultiHostClient.Snapshot.
+type HostState struct {
+
+	// Key is the host, or the key returned by KeyFunc.
+	Key string
+
+	// RetryAfter is the time before which no requests will be sent, as set by the server (e.g. via
+	// Retry-After). It may be in the past.
+	RetryAfter time.Time
+
+	// ReadyAt is the earliest time at which a request could be sent without waiting, taking both
+	// RetryAfter and the client side budget into account. See RateLimiter.ReadyAt.
+	ReadyAt time.Time
+
+	// Throttled is whether requests must currently wait before being sent.
+	Throttled bool
+
+	// Statuses counts the status codes of the host's most recent responses (up to 100 of them).
+	// Attempts which failed without a response are counted under 0.
+	Statuses map[int]int
+
+	// Rate is the rate, in requests per second, enforced by the client side budget. Zero means no
+	// limit.
+	Rate float64
+
+	// Circuit is the state of the host's circuit breaker.
+	Circuit CircuitState
+
+	// LastUsed is when a request to the host was last made.
+	LastUsed time.Time
+
+	// Waiters is the number of requests currently waiting to be sent, either on rate limits, or
+	// for a MaxConcurrency slot.
+	Waiters int
+}
+
+// ################################
+// #### private host map stuff ####
+// ################################
+
+// hostRateLimiterMap tracks a hostEntry per host (or key), optionally evicting the least recently
+// used entries, and entries that have sat idle.
+type hostRateLimiterMap struct {
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List // of *hostEntry, most recently used at the front
+}
+
+// hostEntry holds the state tracked separately for each host.
+type hostEntry struct {
+	key      string
+	lastUsed time.Time // guarded by the map's lock
+	users    int       // requests holding the entry, guarded by the map's lock
+
+	limiter  RateLimiter
+	sem      semaphore
+	breaker  circuitBreaker
+	statuses recentStatuses
+}
+
+// Host returns the entry for `host`, creating it if needed, and holds it until `release` is called
+// so that it isn't evicted while a request is using it. Entries beyond `maxHosts`, or idle for
+// longer than `idleTTL`, are evicted, unless they're held. Zero means no limit for either.
+func (m *hostRateLimiterMap) Host(
+	host string,
+	maxHosts int,
+	idleTTL time.Duration,
+) (entry *hostEntry, release func()) {
+	now := tyme.Now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.entries == nil {
+		m.entries = map[string]*list.Element{}
+	}
+
+	if elem, ok := m.entries[host]; ok {
+		m.lru.MoveToFront(elem)
+		entry = elem.Value.(*hostEntry)
+	} else {
+		entry = &hostEntry{key: host}
+		m.entries[host] = m.lru.PushFront(entry)
+	}
+	entry.lastUsed = now
+	entry.users++
+
+	if idleTTL > 0 {
+		m.evictIdle(now, idleTTL)
+	}
+	if maxHosts > 0 {
+		m.evictLeastRecentlyUsed(now, maxHosts)
+	}
+
+	var once sync.Once
+	return entry, func() {
+		once.Do(func() {
+			m.lock.Lock()
+			entry.users--
+			m.lock.Unlock()
+		})
+	}
+}
+
+// holdUntilClosed calls `release` once the body of resp is closed, since the request is still in
+// flight until then. If there's no response, or it was returned alongside an error (which callers
+// may ignore), `release` is called immediately.
+func holdUntilClosed(resp *http.Response, err error, release func()) {
+	if resp == nil || resp.Body == nil || err != nil {
+		release()
+		return
+	}
+	resp.Body = releaseOnClose(resp.Body, release)
+}
+
+// evictLeastRecentlyUsed evicts the least recently used entries until at most `maxHosts` remain,
+// sparing busy entries (and the most recently used one). Entries still waiting on the server's
+// Retry-After are only evicted if there's nothing else to evict. Callers must hold m.lock.
+func (m *hostRateLimiterMap) evictLeastRecentlyUsed(now time.Time, maxHosts int) {
+	for _, evictThrottled := range []bool{false, true} {
+		for elem := m.lru.Back(); m.lru.Len() > maxHosts && elem != m.lru.Front(); {
+			prev := elem.Prev()
+			entry := elem.Value.(*hostEntry)
+			if !entry.busy() && (evictThrottled || !entry.throttled(now)) {
+				m.remove(elem)
+			}
+			elem = prev
+		}
+	}
+}
+
+// evictIdle evicts entries unused since `idleTTL` ago, unless the server asked us to wait for
+// longer than that, or they're still busy. Callers must hold m.lock.
+func (m *hostRateLimiterMap) evictIdle(now time.Time, idleTTL time.Duration) {
+	cutoff := now.Add(-idleTTL)
+	for elem := m.lru.Back(); elem != nil; {
+		entry := elem.Value.(*hostEntry)
+		if !entry.lastUsed.Before(cutoff) {
+			return // everything else was used more recently
+		}
+
+		prev := elem.Prev()
+		if !entry.throttled(now) && !entry.busy() {
+			m.remove(elem)
+		}
+		elem = prev
+	}
+}
+
+// busy reports whether any requests hold the entry. Evicting a busy entry would let the next
+// request bypass its rate limits, MaxConcurrency, and circuit breaker, while the busy request's
+// outcome (e.g. a Retry-After) is lost with it. Callers must hold the map's lock.
+func (e *hostEntry) busy() bool {
+	return e.users > 0
+}
+
+// throttled reports whether the server asked us to wait until after `now`.
+func (e *hostEntry) throttled(now time.Time) bool {
+	return e.limiter.t.Time().After(now)
+}
+
+func (m *hostRateLimiterMap) lookup(host string) (*hostEntry, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	elem, ok := m.entries[host]
+	if !ok {
+		return nil, false
+	}
+	return elem.Value.(*hostEntry), true
+}
+
+func (m *hostRateLimiterMap) forget(host string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if elem, ok := m.entries[host]; ok {
+		m.remove(elem)
+	}
+}
+
+func (m *hostRateLimiterMap) snapshot(circuit CircuitBreaker) []HostState {
+	now := tyme.Now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	states := make([]HostState, 0, m.lru.Len())
+	for elem := m.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*hostEntry)
+		readyAt := entry.limiter.ReadyAt()
+		states = append(states, HostState{
+			Key:        entry.key,
+			RetryAfter: entry.limiter.t.Time(),
+			ReadyAt:    readyAt,
+			Throttled:  readyAt.After(now),
+			Statuses:   entry.statuses.counts(),
+			Rate:       entry.limiter.Rate(),
+			Circuit:    entry.breaker.currentState(circuit, now),
+			LastUsed:   entry.lastUsed,
+			Waiters:    entry.limiter.waiting() + entry.sem.waiting(),
+		})
+	}
+	return states
+}
+
+// remove evicts the entry at `elem`. Requests already holding the entry carry on unaffected.
+// Callers must hold m.lock.
+func (m *hostRateLimiterMap) remove(elem *list.Element) {
+	entry := m.lru.Remove(elem).(*hostEntry)
+	delete(m.entries, entry.key)
+}
+
+// recentStatusCount is the number of responses remembered by recentStatuses.
+const recentStatusCount = 100
+
+// recentStatuses remembers the status codes of a host's most recent responses. Methods are safe to
+// call on a nil *recentStatuses, which remembers nothing.
+type recentStatuses struct {
+	lock  sync.Mutex
+	ring  [recentStatusCount]int
+	total int
+}
+
+func (r *recentStatuses) record(status int) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	r.ring[r.total%recentStatusCount] = status
+	r.total++
+	r.lock.Unlock()
+}
+
+func (r *recentStatuses) counts() map[int]int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	n := r.total
+	if n > recentStatusCount {
+		n = recentStatusCount
+	}
+	counts := make(map[int]int)
+	for _, status := range r.ring[:n] {
+		counts[status]++
+	}
+	return counts
+}
@@ -0,0 +1,224 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/testutils"
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostMapEvictsLeastRecentlyUsed(t *testing.T) {
+	m := hostRateLimiterMap{}
+	a := m.use("a", 2, 0)
+	m.use("b", 2, 0)
+	assert.Same(t, a, m.use("a", 2, 0))
+	m.use("c", 2, 0)
+
+	assert.Equal(t, []string{"c", "a"}, hostKeys(m.snapshot(CircuitBreaker{})))
+}
+
+func TestHostMapEvictsIdleHosts(t *testing.T) {
+	m := hostRateLimiterMap{}
+	now := time.Now()
+
+	tyme.FreezeTimeAt(now, func() {
+		m.use("idle", 0, time.Minute)
+		m.use("limited", 0, time.Minute).limiter.SetRetryAfterTime(now.Add(time.Hour))
+	})
+	tyme.FreezeTimeAt(now.Add(30*time.Second), func() {
+		m.use("recent", 0, time.Minute)
+	})
+	tyme.FreezeTimeAt(now.Add(2*time.Minute), func() {
+		m.use("new", 0, time.Minute)
+	})
+
+	// "limited" is idle, but is still waiting on the server
+	assert.Equal(t, []string{"new", "limited"}, hostKeys(m.snapshot(CircuitBreaker{})))
+}
+
+func TestMultiHostClientMemoryIsBounded(t *testing.T) {
+	c := &MultiHostClient{MaxHosts: 100}
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		return testutils.StubResponse(200, ""), nil
+	})
+
+	get := func(from, to int) {
+		for i := from; i < to; i++ {
+			resp, err := c.Get(fmt.Sprintf("https://site%d.com/index", i))
+			assert.Nil(t, err)
+			resp.Body.Close()
+		}
+	}
+
+	get(0, 1000)
+	before := heapInUse()
+	get(1000, 50000)
+	after := heapInUse()
+
+	assert.Len(t, c.Snapshot(), 100)
+	assert.Equal(t, "site49999.com", c.Snapshot()[0].Key)
+	// 49,000 more hosts shouldn't cost more than a few 100 KB.
+	assert.Less(t, after-before, int64(1<<20))
+}
+
+func TestHostMapDoesNotEvictBusyHosts(t *testing.T) {
+	c := &MultiHostClient{MaxHosts: 1, Options: Options{MaxConcurrency: 1}}
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		return testutils.StubResponse(200, ""), nil
+	})
+
+	held, err := c.Get("https://a.com/index")
+	assert.Nil(t, err)
+
+	resp, err := c.Get("https://b.com/index")
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	// a.com still has a request in flight, so it must still be limited to one at a time
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://a.com/index", nil)
+	resp, err = c.Do(req)
+	if !assert.ErrorIs(t, err, context.DeadlineExceeded) {
+		resp.Body.Close()
+	}
+
+	held.Body.Close()
+	resp, err = c.Get("https://a.com/index")
+	assert.Nil(t, err)
+	resp.Body.Close()
+}
+
+func TestHostMapDoesNotEvictHostsInFlight(t *testing.T) {
+	c := &MultiHostClient{MaxHosts: 1}
+	sent := make(chan struct{})
+	respond := make(chan struct{})
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "a.com" {
+			close(sent)
+			<-respond
+			return testutils.StubResponse(200, "", "Retry-After", "3600"), nil
+		}
+		return testutils.StubResponse(200, ""), nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := c.Get("https://a.com/index")
+		if assert.Nil(t, err) {
+			resp.Body.Close()
+		}
+	}()
+	<-sent
+
+	// without MaxConcurrency, nothing but the in flight request itself keeps a.com from eviction
+	resp, err := c.Get("https://b.com/index")
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	close(respond)
+	<-done
+
+	// so a.com's Retry-After must still apply
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://a.com/index", nil)
+	_, err = c.Do(req)
+	var deadlineErr *RetryAfterDeadlineError
+	assert.ErrorAs(t, err, &deadlineErr)
+}
+
+func TestHostMapEvictsThrottledHostsLast(t *testing.T) {
+	m := hostRateLimiterMap{}
+	m.use("limited", 2, 0).limiter.SetRetryAfterDuration(time.Hour)
+	m.use("idle", 2, 0)
+	m.use("new", 2, 0)
+
+	assert.Equal(t, []string{"new", "limited"}, hostKeys(m.snapshot(CircuitBreaker{})))
+}
+
+func TestSnapshotCountsWaiters(t *testing.T) {
+	c := &MultiHostClient{}
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		return testutils.StubResponse(200, ""), nil
+	})
+	c.limiters.use("server.io", 0, 0).limiter.SetRetryAfterDuration(time.Hour)
+
+	sleeping := make(chan struct{})
+	wake := make(chan struct{})
+	tyme.StubSleep(func(time.Duration) { close(sleeping); <-wake }, func() {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.Get("https://server.io/index")
+		}()
+
+		<-sleeping
+		assert.Equal(t, 1, c.Snapshot()[0].Waiters)
+		close(wake)
+		<-done
+	})
+	assert.Equal(t, 0, c.Snapshot()[0].Waiters)
+}
+
+func TestSnapshotReportsRecentStatuses(t *testing.T) {
+	c := &MultiHostClient{RetryAfterPolicy: RetryAfterDurationInHeader}
+	statuses := []int{503, 429, 200}
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		status := statuses[0]
+		statuses = statuses[1:]
+		return testutils.StubResponse(status, "", "Retry-After", "5"), nil
+	})
+
+	now := time.Now()
+	tyme.FreezeTimeAt(now, func() {
+		tyme.StubSleep(func(time.Duration) {}, func() {
+			c.Get("https://server.io/index")
+		})
+
+		state := c.Snapshot()[0]
+		assert.Equal(t, map[int]int{200: 1, 429: 1, 503: 1}, state.Statuses)
+		assert.Equal(t, now.Add(5*time.Second), state.ReadyAt)
+		assert.True(t, state.Throttled)
+	})
+}
+
+func TestRecentStatusesForgetsOldResponses(t *testing.T) {
+	r := recentStatuses{}
+	for i := 0; i < recentStatusCount; i++ {
+		r.record(500)
+	}
+	for i := 0; i < 10; i++ {
+		r.record(200)
+	}
+	assert.Equal(t, map[int]int{200: 10, 500: recentStatusCount - 10}, r.counts())
+}
+
+func hostKeys(states []HostState) []string {
+	keys := make([]string, len(states))
+	for i, s := range states {
+		keys[i] = s.Key
+	}
+	return keys
+}
+
+// use looks up the entry for `host` as a request would, releasing it again straight away.
+func (m *hostRateLimiterMap) use(host string, maxHosts int, idleTTL time.Duration) *hostEntry {
+	entry, release := m.Host(host, maxHosts, idleTTL)
+	release()
+	return entry
+}
+
+func heapInUse() int64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapInuse)
+}
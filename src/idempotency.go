@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// IdempotencyKeyHeader is the header used to mark requests with non-idempotent methods (e.g.
+// POST) as safe to retry. See
+// https://datatracker.ietf.org/doc/draft-ietf-httpapi-idempotency-key-header/
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ################################
+// ######### Private Shit #########
+// ################################
+
+// canRetryNonIdempotent reports whether a request with a non-idempotent method can be retried
+// after failing with `resp` or `err`, without risking the server processing it twice.
+//
+// That's the case when the request carries an idempotency key, when the server explicitly refused
+// to process it (429 and 503), or when the request never made it to the server at all.
+func canRetryNonIdempotent(req *http.Request, resp *http.Response, err error) bool {
+	if req.Header.Get(IdempotencyKeyHeader) != "" {
+		return true
+	}
+
+	if err != nil {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// withIdempotencyKey returns a copy of req with a random idempotency key, if req is a POST
+// without one already.
+func withIdempotencyKey(req *http.Request) (*http.Request, error) {
+	if req.Method != http.MethodPost || req.Header.Get(IdempotencyKeyHeader) != "" {
+		return req, nil
+	}
+
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return req, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set(IdempotencyKeyHeader, key)
+	return req, nil
+}
+
+// newIdempotencyKey returns a random (version 4) UUID.
+func newIdempotencyKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
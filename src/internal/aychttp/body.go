@@ -0,0 +1,71 @@
+package aychttp
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+)
+
+// BufferBody reads req.Body into memory (or a temporary file, if toDisk is set) and sets
+// req.GetBody, so that the body can be replayed. Bodies larger than limit are left unbuffered,
+// without GetBody, although req.Body still yields the entire original body.
+//
+// cleanup releases any temporary file, and must be called once req is no longer in use.
+func BufferBody(req *http.Request, limit int64, toDisk bool) (cleanup func(), err error) {
+	cleanup = func() {}
+	original := req.Body
+
+	var buf io.ReadWriter
+	var file *os.File
+	if toDisk {
+		if file, err = os.CreateTemp("", "ratelimit-body-*"); err != nil {
+			return cleanup, err
+		}
+		cleanup = func() {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+		buf = file
+	} else {
+		buf = new(bytes.Buffer)
+	}
+
+	n, err := io.Copy(buf, io.LimitReader(original, limit+1))
+	if err != nil {
+		_ = original.Close()
+		return cleanup, err
+	}
+
+	replay := func() (io.ReadCloser, error) {
+		if file != nil {
+			return io.NopCloser(io.NewSectionReader(file, 0, n)), nil
+		}
+		return io.NopCloser(bytes.NewReader(buf.(*bytes.Buffer).Bytes())), nil
+	}
+
+	if n > limit {
+		// Too big to buffer. Stitch the body back together, so it can at least be sent once.
+		buffered, _ := replay()
+		req.Body = readCloser{io.MultiReader(buffered, original), original}
+		return cleanup, nil
+	}
+
+	_ = original.Close()
+	req.ContentLength = n
+	req.GetBody = replay
+	req.Body, err = replay()
+	return cleanup, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// DrainAndClose reads (and discards) up to limit bytes from body before closing it. Fully reading
+// a response body allows its connection to be reused.
+func DrainAndClose(body io.ReadCloser, limit int64) error {
+	_, _ = io.CopyN(io.Discard, body, limit)
+	return body.Close()
+}
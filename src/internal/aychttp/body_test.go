@@ -0,0 +1,92 @@
+package aychttp
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// onlyReader hides any other methods of the underlying reader, so that http.NewRequest can't set
+// GetBody.
+type onlyReader struct {
+	io.Reader
+}
+
+func newRequest(body string) *http.Request {
+	req, _ := http.NewRequest("POST", "https://server.io", onlyReader{strings.NewReader(body)})
+	return req
+}
+
+func readAll(t *testing.T, rc io.ReadCloser) string {
+	b, err := io.ReadAll(rc)
+	assert.Nil(t, err)
+	assert.Nil(t, rc.Close())
+	return string(b)
+}
+
+func TestHasBody(t *testing.T) {
+	assert.True(t, HasBody(newRequest("body")))
+
+	req, _ := http.NewRequest("GET", "https://server.io", nil)
+	assert.False(t, HasBody(req))
+
+	req, _ = http.NewRequest("POST", "https://server.io", strings.NewReader(""))
+	assert.False(t, HasBody(req))
+}
+
+func TestBufferBody(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		req := newRequest("the body")
+		assert.Nil(t, req.GetBody)
+
+		cleanup, err := BufferBody(req, 100, toDisk)
+		assert.Nil(t, err)
+
+		assert.EqualValues(t, 8, req.ContentLength)
+		assert.Equal(t, "the body", readAll(t, req.Body))
+
+		for i := 0; i < 2; i++ {
+			body, err := req.GetBody()
+			assert.Nil(t, err)
+			assert.Equal(t, "the body", readAll(t, body))
+		}
+
+		cleanup()
+	}
+}
+
+func TestBufferBodyTooLarge(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		req := newRequest("the body")
+
+		cleanup, err := BufferBody(req, 4, toDisk)
+		assert.Nil(t, err)
+
+		assert.Nil(t, req.GetBody)
+		assert.Equal(t, "the body", readAll(t, req.Body))
+
+		cleanup()
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestDrainAndClose(t *testing.T) {
+	r := strings.NewReader("0123456789")
+	body := &closeRecorder{Reader: r}
+
+	assert.Nil(t, DrainAndClose(body, 4))
+	assert.True(t, body.closed)
+	assert.Equal(t, 6, r.Len())
+}
@@ -3,12 +3,26 @@ package aychttp
 import "net/http"
 
 func HasBody(req *http.Request) bool {
-	return req.Header.Get("Content-Type") != ""
+	return req.Body != nil && req.Body != http.NoBody
 }
 
 func IsRetryable(resp *http.Response) bool {
-	status := resp.StatusCode
+	return IsRetryableStatus(resp.StatusCode)
+}
+
+func IsRetryableStatus(status int) bool {
 	return status == http.StatusTooManyRequests ||
 		status == http.StatusServiceUnavailable ||
 		status == http.StatusInternalServerError
 }
+
+// IsIdempotent reports whether req's method is idempotent, as defined by RFC 9110, meaning it can
+// be safely retried even if the server already processed it.
+func IsIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
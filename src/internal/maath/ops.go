@@ -1,5 +1,7 @@
 package maath
 
+import "time"
+
 func MaxPowerOf2(pow uint64) (x uint64) {
 	if pow > 63 { // Guard against overflow
 		pow = 63
@@ -7,3 +9,31 @@ func MaxPowerOf2(pow uint64) (x uint64) {
 	x = (1 << pow)
 	return x
 }
+
+func MaxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func MaxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// SaturatingPow returns x * base^pow, or max if the result would exceed max.
+func SaturatingPow(x, base, pow, max uint64) uint64 {
+	if x > max {
+		return max
+	}
+	for i := uint64(0); i < pow; i++ {
+		if base != 0 && x > max/base {
+			return max
+		}
+		x *= base
+	}
+	return x
+}
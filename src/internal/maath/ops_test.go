@@ -2,6 +2,7 @@ package maath
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -22,3 +23,15 @@ func TestGuardedPowerOf2Overflow(t *testing.T) {
 	var max uint64 = 9_223_372_036_854_775_808 //uint64(math.MaxUint64)
 	assert.EqualValues(t, max, overflow)
 }
+
+func TestMaxDuration(t *testing.T) {
+	assert.Equal(t, time.Second, MaxDuration(time.Second, 0))
+	assert.Equal(t, time.Duration(0), MaxDuration(-time.Second, 0))
+}
+
+func TestSaturatingPow(t *testing.T) {
+	assert.EqualValues(t, 24, SaturatingPow(3, 2, 3, 100))
+	assert.EqualValues(t, 100, SaturatingPow(3, 2, 6, 100))
+	assert.EqualValues(t, 100, SaturatingPow(3, 2, 1000, 100))
+	assert.EqualValues(t, 100, SaturatingPow(300, 2, 0, 100))
+}
@@ -1,13 +1,15 @@
 package tyme
 
 import (
+	"context"
 	"sync"
 	"time"
 )
 
 var (
-	sleepFunc = time.Sleep
-	sfLock    sync.Mutex
+	sleepFunc        = time.Sleep
+	sleepContextFunc = sleepContext
+	sfLock           sync.Mutex
 )
 
 func Sleep(d time.Duration) time.Duration {
@@ -15,13 +17,43 @@ func Sleep(d time.Duration) time.Duration {
 	return d
 }
 
+// SleepContext is like Sleep, but returns early with ctx.Err() if ctx is done before d elapses.
+func SleepContext(ctx context.Context, d time.Duration) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return sleepContextFunc(ctx, d)
+}
+
 func StubSleep(sleep func(time.Duration), f func()) {
 	sfLock.Lock()
 	defer func() {
 		sleepFunc = time.Sleep
+		sleepContextFunc = sleepContext
 		sfLock.Unlock()
 	}()
 
 	sleepFunc = sleep
+	sleepContextFunc = func(ctx context.Context, d time.Duration) (time.Duration, error) {
+		sleep(d)
+		return d, ctx.Err()
+	}
 	f()
 }
+
+func sleepContext(ctx context.Context, d time.Duration) (time.Duration, error) {
+	if d <= 0 {
+		return d, nil
+	}
+
+	start := time.Now()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return d, nil
+	case <-ctx.Done():
+		return time.Since(start), ctx.Err()
+	}
+}
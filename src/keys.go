@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// KeyFunc decides which rate limiter a request belongs to. Requests with the same key share rate
+// limits (and concurrency limits, and circuit breakers), while requests with different keys are
+// tracked separately. The key itself is opaque, but shows up in errors like *CircuitOpenError.
+//
+// HostKey is the default. APIs that rate limit each endpoint group, access token, or tenant
+// separately are better served by PathPrefixKey, AuthorizationKey, or a KeyFunc of your own.
+type KeyFunc func(req *http.Request) string
+
+// HostKey keys requests by host, e.g. "api.github.com".
+func HostKey(req *http.Request) string {
+	return requestHost(req)
+}
+
+// PathPrefixKey keys requests by host and the first of `prefixes` that the request's path starts
+// with, e.g. "api.github.com/search" for PathPrefixKey("/search"). Requests matching none of the
+// prefixes are keyed by host alone. For GitHub, whose search API is rate limited separately from
+// the rest:
+//
+//	client := ratelimit.MultiHostClient{KeyFunc: ratelimit.PathPrefixKey("/search")}
+func PathPrefixKey(prefixes ...string) KeyFunc {
+	return func(req *http.Request) string {
+		host := requestHost(req)
+		for _, p := range prefixes {
+			if strings.HasPrefix(req.URL.Path, p) {
+				return host + p
+			}
+		}
+		return host
+	}
+}
+
+// HeaderKey keys requests by host and a hash of the `name` header, e.g. "api.example.com#3f0a..."
+// Only the hash is kept, so secrets don't end up in keys (or error messages). Requests without
+// the header are keyed by host alone.
+func HeaderKey(name string) KeyFunc {
+	return func(req *http.Request) string {
+		host := requestHost(req)
+		value := req.Header.Get(name)
+		if value == "" {
+			return host
+		}
+		sum := sha256.Sum256([]byte(value))
+		return host + "#" + hex.EncodeToString(sum[:8])
+	}
+}
+
+// AuthorizationKey keys requests by host and a hash of the Authorization header, for APIs that
+// rate limit each access token separately.
+var AuthorizationKey = HeaderKey("Authorization")
+
+// JoinKeys keys requests by every one of `fns`, for when requests are rate limited along several
+// dimensions at once. For example, per endpoint group and per tenant:
+//
+//	ratelimit.JoinKeys(ratelimit.PathPrefixKey("/search"), ratelimit.HeaderKey("X-Tenant-ID"))
+func JoinKeys(fns ...KeyFunc) KeyFunc {
+	return func(req *http.Request) string {
+		keys := make([]string, len(fns))
+		for i, fn := range fns {
+			keys[i] = fn(req)
+		}
+		return strings.Join(keys, " ")
+	}
+}
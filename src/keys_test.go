@@ -0,0 +1,29 @@
+package ratelimit
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyFuncs(t *testing.T) {
+	search, _ := http.NewRequest("GET", "https://api.github.com/search/code", nil)
+	core, _ := http.NewRequest("GET", "https://api.github.com/repos/foo", nil)
+	core.Header.Set("Authorization", "token secret")
+
+	assert.Equal(t, "api.github.com", HostKey(search))
+
+	byPath := PathPrefixKey("/search", "/graphql")
+	assert.Equal(t, "api.github.com/search", byPath(search))
+	assert.Equal(t, "api.github.com", byPath(core))
+
+	assert.Equal(t, "api.github.com", AuthorizationKey(search))
+	key := AuthorizationKey(core)
+	assert.NotContains(t, key, "secret")
+	assert.Regexp(t, `^api\.github\.com#[0-9a-f]{16}$`, key)
+
+	joined := JoinKeys(byPath, AuthorizationKey)
+	assert.Equal(t, "api.github.com/search api.github.com", joined(search))
+	assert.Equal(t, "api.github.com "+key, joined(core))
+}
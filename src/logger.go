@@ -0,0 +1,21 @@
+package ratelimit
+
+// Logger receives debug logs of every attempt, wait, and retry decision, as alternating keys and
+// values:
+//
+//	logger.Debug("ratelimit: attempt", "key", "api.foo.com", "attempt", 1, "status", 429, ...)
+//
+// *slog.Logger satisfies Logger, as do most structured loggers (sometimes via a small adapter).
+type Logger interface {
+	Debug(msg string, args ...interface{})
+}
+
+// ################################
+// ##### private logger stuff #####
+// ################################
+
+func debug(l Logger, msg string, args ...interface{}) {
+	if l != nil {
+		l.Debug(msg, args...)
+	}
+}
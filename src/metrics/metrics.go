@@ -0,0 +1,270 @@
+// Package metrics collects metrics from a ratelimit client's Hooks, and renders them in the
+// Prometheus text exposition format, without depending on the Prometheus client library.
+//
+//	collector := &metrics.Collector{}
+//	client := ratelimit.MultiHostClient{}
+//	client.Hooks = collector.Hooks()
+//	collector.Snapshot = client.Snapshot
+//
+//	http.Handle("/metrics", collector)
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ratelimit "github.com/gabehardgrave/ratelimit/src"
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+)
+
+// DefaultBuckets are the histogram buckets used when Collector.Buckets is nil, in seconds.
+var DefaultBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// Collector collects metrics about requests, retries, and time spent throttled, labelled by host
+// (or by the key returned by the client's KeyFunc):
+//
+//	ratelimit_requests_total{host, status}       counter of attempts, by status code (or "error")
+//	ratelimit_retries_total{host, reason}        counter of retries, by status code (or "error")
+//	ratelimit_throttled_seconds{host}            histogram of time spent waiting on rate limits
+//	ratelimit_retry_after_seconds{host}          gauge of time until the host allows requests
+//	ratelimit_waiters{host}                      gauge of requests waiting to be sent
+//
+// The gauges are only reported when Snapshot is set. The zero value is ready to use.
+type Collector struct {
+
+	// Namespace prefixes every metric name. If Namespace is empty, "ratelimit" is used.
+	Namespace string
+
+	// Buckets are the upper bounds of the histogram buckets, in seconds. If Buckets is nil,
+	// DefaultBuckets are used. Buckets must not change once metrics have been collected.
+	Buckets []float64
+
+	// Snapshot, if set, is called whenever metrics are rendered, to report the state of each host
+	// (usually MultiHostClient.Snapshot or Transport.Snapshot).
+	Snapshot func() []ratelimit.HostState
+
+	lock      sync.Mutex
+	requests  map[labels]uint64
+	retries   map[labels]uint64
+	throttled map[string]*histogram
+}
+
+// Hooks returns the Hooks which feed the Collector. Set them on a Client, MultiHostClient, or
+// Transport, or combine them with other Hooks (e.g. a tracing.Tracer's) using ratelimit.JoinHooks.
+func (c *Collector) Hooks() ratelimit.Hooks {
+	return ratelimit.Hooks{
+		OnAttemptEnd: func(ev ratelimit.HookEvent) {
+			c.inc(&c.requests, labels{ev.Key, outcome(ev)})
+		},
+		OnRetryScheduled: func(ev ratelimit.HookEvent) {
+			c.inc(&c.retries, labels{ev.Key, outcome(ev)})
+		},
+		OnWait: func(ev ratelimit.HookEvent) {
+			c.observe(ev.Key, ev.Wait)
+		},
+	}
+}
+
+// ServeHTTP renders the metrics, so the Collector can be scraped directly.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+// WriteTo renders the metrics to w in the Prometheus text exposition format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	ns := c.namespace()
+
+	c.lock.Lock()
+	writeCounter(cw, ns+"_requests_total", "Attempts sent, by host and status.",
+		"status", c.requests)
+	writeCounter(cw, ns+"_retries_total", "Retries scheduled, by host and reason.",
+		"reason", c.retries)
+	c.writeHistogram(cw, ns+"_throttled_seconds",
+		"Time spent waiting on rate limits before an attempt.")
+	c.lock.Unlock()
+
+	if c.Snapshot != nil {
+		c.writeGauges(cw, ns, c.Snapshot())
+	}
+
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+// ###############################
+// #### private metrics stuff ####
+// ###############################
+
+type labels struct {
+	host, value string
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (c *Collector) namespace() string {
+	if c.Namespace == "" {
+		return "ratelimit"
+	}
+	return c.Namespace
+}
+
+func (c *Collector) buckets() []float64 {
+	if c.Buckets == nil {
+		return DefaultBuckets
+	}
+	return c.Buckets
+}
+
+func (c *Collector) inc(m *map[labels]uint64, l labels) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if *m == nil {
+		*m = map[labels]uint64{}
+	}
+	(*m)[l]++
+}
+
+func (c *Collector) observe(host string, d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.throttled == nil {
+		c.throttled = map[string]*histogram{}
+	}
+	h, ok := c.throttled[host]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(c.buckets()))}
+		c.throttled[host] = h
+	}
+
+	seconds := d.Seconds()
+	for i, upper := range c.buckets() {
+		if seconds <= upper {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// outcome labels an attempt by its status code, or "error" if it failed without a response.
+func outcome(ev ratelimit.HookEvent) string {
+	if ev.StatusCode == 0 {
+		return "error"
+	}
+	return strconv.Itoa(ev.StatusCode)
+}
+
+func writeCounter(w io.Writer, name, help, label string, m map[labels]uint64) {
+	writeHeader(w, name, help, "counter")
+
+	keys := make([]labels, 0, len(m))
+	for l := range m {
+		keys = append(keys, l)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].host != keys[j].host {
+			return keys[i].host < keys[j].host
+		}
+		return keys[i].value < keys[j].value
+	})
+
+	for _, l := range keys {
+		fmt.Fprintf(w, "%s{host=%s,%s=%s} %d\n", name, quote(l.host), label, quote(l.value), m[l])
+	}
+}
+
+// writeHistogram writes the throttled histogram. Callers must hold c.lock.
+func (c *Collector) writeHistogram(w io.Writer, name, help string) {
+	writeHeader(w, name, help, "histogram")
+
+	for _, host := range sortedKeys(c.throttled) {
+		h := c.throttled[host]
+		var cumulative uint64
+		for i, upper := range c.buckets() {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{host=%s,le=%s} %d\n",
+				name, quote(host), quote(formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{host=%s,le=\"+Inf\"} %d\n", name, quote(host), h.count)
+		fmt.Fprintf(w, "%s_sum{host=%s} %s\n", name, quote(host), formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{host=%s} %d\n", name, quote(host), h.count)
+	}
+}
+
+func (c *Collector) writeGauges(w io.Writer, ns string, states []ratelimit.HostState) {
+	sort.Slice(states, func(i, j int) bool { return states[i].Key < states[j].Key })
+	now := tyme.Now()
+
+	writeHeader(w, ns+"_retry_after_seconds",
+		"Time until the host allows requests again, as set by the server.", "gauge")
+	for _, s := range states {
+		horizon := math.Max(s.RetryAfter.Sub(now).Seconds(), 0)
+		fmt.Fprintf(w, "%s_retry_after_seconds{host=%s} %s\n",
+			ns, quote(s.Key), formatFloat(horizon))
+	}
+
+	writeHeader(w, ns+"_waiters", "Requests currently waiting to be sent.", "gauge")
+	for _, s := range states {
+		fmt.Fprintf(w, "%s_waiters{host=%s} %d\n", ns, quote(s.Key), s.Waiters)
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedKeys(m map[string]*histogram) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quote(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// countingWriter remembers the bytes written, and the first error, so that the writes above
+// needn't check each one.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ratelimit "github.com/gabehardgrave/ratelimit/src"
+	"github.com/gabehardgrave/ratelimit/src/internal/testutils"
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	collector := &Collector{Buckets: []float64{1, 10}}
+	client := &ratelimit.MultiHostClient{
+		RetryAfterPolicy: ratelimit.RetryAfterDurationInHeader,
+		Options:          ratelimit.Options{Hooks: collector.Hooks()},
+	}
+	collector.Snapshot = client.Snapshot
+
+	b := testutils.Repeater(1)
+	client.C.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "foo.com" && <-b {
+			return testutils.StubResponse(429, "", "Retry-After", "5"), nil
+		}
+		return testutils.StubResponse(200, ""), nil
+	})
+
+	now := time.Now()
+	tyme.FreezeTimeAt(now, func() {
+		tyme.StubSleep(func(time.Duration) {}, func() {
+			client.Get("https://foo.com/")
+			client.Get("https://bar.com/")
+		})
+	})
+
+	var out strings.Builder
+	tyme.FreezeTimeAt(now.Add(2*time.Second), func() {
+		n, err := collector.WriteTo(&out)
+		assert.Nil(t, err)
+		assert.EqualValues(t, out.Len(), n)
+	})
+
+	assert.Equal(t, `# HELP ratelimit_requests_total Attempts sent, by host and status.
+# TYPE ratelimit_requests_total counter
+ratelimit_requests_total{host="bar.com",status="200"} 1
+ratelimit_requests_total{host="foo.com",status="200"} 1
+ratelimit_requests_total{host="foo.com",status="429"} 1
+# HELP ratelimit_retries_total Retries scheduled, by host and reason.
+# TYPE ratelimit_retries_total counter
+ratelimit_retries_total{host="foo.com",reason="429"} 1
+# HELP ratelimit_throttled_seconds Time spent waiting on rate limits before an attempt.
+# TYPE ratelimit_throttled_seconds histogram
+ratelimit_throttled_seconds_bucket{host="foo.com",le="1"} 0
+ratelimit_throttled_seconds_bucket{host="foo.com",le="10"} 1
+ratelimit_throttled_seconds_bucket{host="foo.com",le="+Inf"} 1
+ratelimit_throttled_seconds_sum{host="foo.com"} 5
+ratelimit_throttled_seconds_count{host="foo.com"} 1
+# HELP ratelimit_retry_after_seconds Time until the host allows requests again, as set by the server.
+# TYPE ratelimit_retry_after_seconds gauge
+ratelimit_retry_after_seconds{host="bar.com"} 0
+ratelimit_retry_after_seconds{host="foo.com"} 3
+# HELP ratelimit_waiters Requests currently waiting to be sent.
+# TYPE ratelimit_waiters gauge
+ratelimit_waiters{host="bar.com"} 0
+ratelimit_waiters{host="foo.com"} 0
+`, out.String())
+}
+
+func TestCollectorServeHTTP(t *testing.T) {
+	collector := &Collector{Namespace: "api"}
+	collector.Hooks().OnAttemptEnd(ratelimit.HookEvent{Key: `we"ird`})
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `api_requests_total{host="we\"ird",status="error"} 1`)
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
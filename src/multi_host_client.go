@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
-	"sync"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
 )
 
 // MultiHostClient is a wrapper over http.Client that retries requests and honors rate limits.
@@ -28,6 +30,30 @@ type MultiHostClient struct {
 	// before retrying. If RetryAfterPolicy is nil, the Client will use IdiomaticRetryAfter.
 	RetryAfterPolicy RetryAfterPolicy
 
+	// Options configure retries, and the client side rate limits enforced on top of the server's.
+	// Limit, Adaptive, and MaxConcurrency apply separately to each host. See Options.
+	Options
+
+	// KeyFunc decides which requests share rate limits. If KeyFunc is nil, requests are keyed by
+	// host (see HostKey). The methods taking a `host` accept any key returned by KeyFunc.
+	KeyFunc KeyFunc
+
+	// MaxHosts is the maximum number of hosts (or keys) tracked at once. Past it, the least
+	// recently used host is forgotten, as if by ForgetHost. Hosts with requests in flight or
+	// waiting aren't forgotten, so MaxHosts may be briefly exceeded, and hosts still waiting on a
+	// server imposed Retry-After are only forgotten if no others can be. Zero means no limit.
+	MaxHosts int
+
+	// HostIdleTTL is how long a host may go without requests before it's forgotten. Hosts are
+	// never forgotten while a server imposed Retry-After is still pending, or while requests to
+	// them are in flight or waiting. Zero means hosts are never forgotten for being idle.
+	HostIdleTTL time.Duration
+
+	// CircuitBreaker, if enabled, fails requests fast with a *CircuitOpenError (matching
+	// ErrCircuitOpen) while a host is failing, rather than retrying them. Circuits are tracked
+	// separately for each host. See CircuitBreaker.
+	CircuitBreaker CircuitBreaker
+
 	limiters hostRateLimiterMap
 }
 
@@ -36,19 +62,20 @@ func (c *MultiHostClient) CloseIdleConnections() {
 }
 
 func (c *MultiHostClient) Do(req *http.Request) (*http.Response, error) {
-	policy := c.RetryAfterPolicy
-	if policy == nil {
-		policy = IdiomaticRetryAfter
-	}
-
-	host := req.Host
-	if host == "" {
-		host = req.URL.Host // host might still be empty, but at least we tried.
-	}
-
-	limiter := c.limiters.HostLimiter(host)
 
-	return limiter.do(req, &c.C, policy)
+	key := c.key(req)
+	host, release := c.limiters.Host(key, c.MaxHosts, c.HostIdleTTL)
+	host.limiter.setBudget(c.Limit, c.Adaptive)
+
+	opts := c.doOptions(c.RetryAfterPolicy)
+	opts.sem = &host.sem
+	opts.statuses = &host.statuses
+	opts.key = key
+	opts.breaker = &host.breaker
+	opts.circuit = c.CircuitBreaker
+	resp, err := host.limiter.do(req, c.C.Do, opts)
+	holdUntilClosed(resp, err, release)
+	return resp, err
 }
 
 func (c *MultiHostClient) Get(url string) (resp *http.Response, err error) {
@@ -81,18 +108,49 @@ func (c *MultiHostClient) PostForm(url string, data url.Values) (resp *http.Resp
 }
 
 func (c *MultiHostClient) ForgetHost(host string) {
-	c.limiters.m.Delete(host)
+	c.limiters.forget(host)
+}
+
+// Snapshot lists the hosts (or keys) currently tracked, along with their state, most recently used
+// first.
+func (c *MultiHostClient) Snapshot() []HostState {
+	return c.limiters.snapshot(c.CircuitBreaker)
+}
+
+// CircuitState returns the state of host's circuit breaker. Unknown hosts are CircuitClosed.
+func (c *MultiHostClient) CircuitState(host string) CircuitState {
+	entry, ok := c.limiters.lookup(host)
+	if !ok {
+		return CircuitClosed
+	}
+	return entry.breaker.currentState(c.CircuitBreaker, tyme.Now())
+}
+
+// Rate returns the rate, in requests per second, currently enforced for host. With Adaptive
+// enabled, this is the rate learned for host so far. Zero means no limit, or an unknown host.
+func (c *MultiHostClient) Rate(host string) float64 {
+	entry, ok := c.limiters.lookup(host)
+	if !ok {
+		return 0
+	}
+	return entry.limiter.Rate()
 }
 
 // ################################
 // ### private multi host stuff ###
 // ################################
 
-type hostRateLimiterMap struct {
-	m sync.Map
+func (c *MultiHostClient) key(req *http.Request) string {
+	if c.KeyFunc == nil {
+		return requestHost(req)
+	}
+	return c.KeyFunc(req)
 }
 
-func (m *hostRateLimiterMap) HostLimiter(host string) *RateLimiter {
-	limiter, _ := m.m.LoadOrStore(host, &RateLimiter{})
-	return limiter.(*RateLimiter)
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host // host might still be empty, but at least we tried.
+	}
+	return host
 }
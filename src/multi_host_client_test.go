@@ -1,6 +1,7 @@
 package ratelimit
 
 import (
+	"errors"
 	"net/http"
 	"testing"
 	"time"
@@ -63,6 +64,77 @@ func TestPerHostRateLimiting(t *testing.T) {
 	})
 }
 
+func TestCircuitBreakerFailsFast(t *testing.T) {
+	c := multiHostClientWithPolicy(func(*http.Response, ...*http.Response) (bool, time.Time) {
+		return false, time.Time{}
+	})
+	c.CircuitBreaker = CircuitBreaker{FailureRatio: 1, MinRequests: 2, CoolDown: time.Minute}
+
+	sent := map[string]int{}
+	healthy := false
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		sent[req.URL.Host]++
+		if req.URL.Host == "site1.com" && !healthy {
+			return testutils.StubResponse(503, ""), nil
+		}
+		return testutils.StubResponse(200, ""), nil
+	})
+
+	now := time.Now()
+	tyme.FreezeTimeAt(now, func() {
+		for i := 0; i < 2; i++ {
+			resp, err := c.Get("https://site1.com/index")
+			assert.Nil(t, err)
+			assert.Equal(t, 503, resp.StatusCode)
+		}
+		assert.Equal(t, CircuitOpen, c.CircuitState("site1.com"))
+
+		_, err := c.Get("https://site1.com/index")
+		assert.True(t, errors.Is(err, ErrCircuitOpen))
+		assert.Equal(t, 2, sent["site1.com"])
+
+		resp, err := c.Get("https://site2.com/index")
+		assert.Nil(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+
+	healthy = true
+	tyme.FreezeTimeAt(now.Add(time.Minute), func() {
+		assert.Equal(t, CircuitHalfOpen, c.CircuitState("site1.com"))
+		resp, err := c.Get("https://site1.com/index")
+		assert.Nil(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, CircuitClosed, c.CircuitState("site1.com"))
+	})
+}
+
+func TestKeyFunc(t *testing.T) {
+	c := multiHostClientWithPolicy(RetryAfterDurationInHeader)
+	c.KeyFunc = PathPrefixKey("/search")
+	b := testutils.Repeater(1)
+
+	c.stubRequest(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/search" && <-b {
+			return testutils.StubResponse(429, "", "Retry-After", "10"), nil
+		}
+		return testutils.StubResponse(200, ""), nil
+	})
+
+	now := time.Now()
+	tyme.FreezeTimeAt(now, func() {
+		tyme.StubSleep(func(time.Duration) {}, func() {
+			resp, _ := c.Get("https://api.github.com/search")
+			assert.Equal(t, 200, resp.StatusCode)
+		})
+
+		// the core endpoints aren't held up by the search rate limit
+		tyme.StubSleep(func(d time.Duration) { assert.LessOrEqual(t, d, time.Duration(0)) }, func() {
+			resp, _ := c.Get("https://api.github.com/repos/foo")
+			assert.Equal(t, 200, resp.StatusCode)
+		})
+	})
+}
+
 func multiHostClientWithPolicy(policy RetryAfterPolicy) *MultiHostClient {
 	return &MultiHostClient{
 		RetryAfterPolicy: policy,
@@ -0,0 +1,128 @@
+package ratelimit
+
+import "time"
+
+// Options are the retry and rate limiting settings shared by Client, MultiHostClient, and
+// Transport, each of which embeds them. Where a setting differs between them, MultiHostClient
+// (and Transport, with PerHost set) applies it separately to each host.
+//
+// The zero value retries according to the owning client's RetryAfterPolicy, with no other limits.
+type Options struct {
+
+	// AttemptPolicy is like RetryAfterPolicy, but receives a record of previous attempts rather
+	// than previous responses. If set, AttemptPolicy is used instead of RetryAfterPolicy.
+	AttemptPolicy AttemptPolicy
+
+	// RetryErrorPolicy is the policy used to determine whether to retry requests that failed
+	// without a response (e.g. connection resets). If RetryErrorPolicy is nil,
+	// RetryTransientErrors is used.
+	RetryErrorPolicy RetryErrorPolicy
+
+	// Limit is a client side request budget, enforced before every request (including retries)
+	// so that the server's rate limit is never hit in the first place. The zero value imposes no
+	// limit. Rate limits communicated by the server are honored on top of Limit.
+	Limit Limit
+
+	// Adaptive, if enabled, replaces Limit with a budget learned from the server's responses: the
+	// rate grows while requests succeed, and is cut whenever the server responds with a 429 or
+	// 503. See AdaptiveLimit.
+	Adaptive AdaptiveLimit
+
+	// MaxConcurrency is the maximum number of requests in flight at once. Further requests wait
+	// (in FIFO order) until an earlier request completes, or until their context is done. A
+	// request is in flight until its response body is closed, unless Do returns it alongside an
+	// error (e.g. a *RetriesExhaustedError), in which case its body must still be closed, but no
+	// longer counts. Zero means no limit.
+	MaxConcurrency int
+
+	// MaxRetries is the maximum number of times a request will be retried. Once exceeded, Do
+	// returns the last response along with a *RetriesExhaustedError (Transport's RoundTrip
+	// returns just the last response). Zero means no limit, other than that imposed by the
+	// RetryAfterPolicy.
+	MaxRetries int
+
+	// MaxTotalWait is the maximum total time a request will spend waiting between retries. If the
+	// next retry would exceed it, the request gives up just as if MaxRetries were exceeded. Zero
+	// means no limit, other than that imposed by the RetryAfterPolicy.
+	MaxTotalWait time.Duration
+
+	// RetryNonIdempotent retries requests with non-idempotent methods (e.g. POST and PATCH) just
+	// like any other. By default, such requests are only retried on 429 and 503 responses (which
+	// indicate the server didn't process them), on connection failures, or when they carry an
+	// Idempotency-Key header, since retrying them might otherwise duplicate their effects.
+	RetryNonIdempotent bool
+
+	// AutoIdempotencyKey attaches a random Idempotency-Key header to POST requests that don't
+	// already have one, making them safe to retry (for servers that support the header). The
+	// caller's request is not modified.
+	AutoIdempotencyKey bool
+
+	// MaxBufferedBodySize is the size of the largest request body that will be buffered, so that
+	// it can be replayed on retries. Only bodies of requests without a GetBody are buffered
+	// (http.NewRequest sets GetBody for *bytes.Buffer, *bytes.Reader, and *strings.Reader
+	// bodies). Requests with larger bodies are sent once, and fail with ErrBodyNotReplayable
+	// rather than being retried. Zero disables buffering.
+	MaxBufferedBodySize int64
+
+	// BufferBodiesToDisk buffers request bodies (see MaxBufferedBodySize) in a temporary file,
+	// rather than in memory.
+	BufferBodiesToDisk bool
+
+	// MaxDrainBytes is the maximum number of bytes read from the body of a response that's being
+	// retried, before it's closed. Reading the body in full allows the connection to be reused,
+	// rather than torn down. If MaxDrainBytes is zero, DefaultMaxDrainBytes is used. If negative,
+	// bodies are closed without being read.
+	MaxDrainBytes int64
+
+	// Hooks are called as each request is attempted, waits, retries, or fails. See Hooks.
+	Hooks Hooks
+
+	// Logger, if set, receives debug logs of every attempt, wait, and retry decision, including
+	// any Retry-After or rate limit headers the built-in policies couldn't parse.
+	Logger Logger
+}
+
+// ################################
+// #### private options stuff #####
+// ################################
+
+// doOptions resolves the Options, falling back to `retryAfterPolicy` (or IdiomaticRetryAfter) when
+// AttemptPolicy isn't set. Callers fill in the per host fields themselves.
+func (o *Options) doOptions(retryAfterPolicy RetryAfterPolicy) doOptions {
+	policy := o.AttemptPolicy
+	if policy == nil {
+		if retryAfterPolicy == nil {
+			retryAfterPolicy = IdiomaticRetryAfter
+		}
+		policy = retryAfterPolicy.AttemptPolicy()
+	}
+
+	errorPolicy := o.RetryErrorPolicy
+	if errorPolicy == nil {
+		errorPolicy = RetryTransientErrors
+	}
+
+	maxDrainBytes := o.MaxDrainBytes
+	if maxDrainBytes == 0 {
+		maxDrainBytes = DefaultMaxDrainBytes
+	}
+
+	return doOptions{
+		policy:       policy,
+		errorPolicy:  errorPolicy,
+		maxRetries:   o.MaxRetries,
+		maxTotalWait: o.MaxTotalWait,
+
+		retryNonIdempotent: o.RetryNonIdempotent,
+		autoIdempotencyKey: o.AutoIdempotencyKey,
+
+		maxBufferedBodySize: o.MaxBufferedBodySize,
+		bufferBodiesToDisk:  o.BufferBodiesToDisk,
+
+		maxDrainBytes:  maxDrainBytes,
+		maxConcurrency: o.MaxConcurrency,
+
+		hooks:  o.Hooks,
+		logger: o.Logger,
+	}
+}
@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+)
+
+// PolicyBuilder composes a RetryAfterPolicy from common building blocks, rather than writing a
+// custom RetryAfterPolicy from scratch. e.g.
+//
+//	policy := ratelimit.NewPolicy().
+//		RetryOn(429, 502, 503, 504).
+//		HonorRetryAfter().
+//		Backoff(ratelimit.Backoff{Jitter: ratelimit.FullJitter}).
+//		MaxAttempts(5).
+//		Build()
+//
+// Builder methods modify and return the same PolicyBuilder. Policies returned by Build are
+// unaffected by later modifications.
+type PolicyBuilder struct {
+	isRetryable     StatusClassifier
+	honorRetryAfter bool
+	backoff         *Backoff
+	maxAttempts     int
+}
+
+// NewPolicy returns a PolicyBuilder. On its own, the built policy retries immediately on status
+// codes classified as retryable by DefaultRetryableStatus (429, 500, and 503 by default).
+func NewPolicy() *PolicyBuilder {
+	return &PolicyBuilder{isRetryable: defaultRetryableStatus}
+}
+
+// RetryOn sets the status codes which should be retried, replacing the default of status codes
+// classified as retryable by DefaultRetryableStatus (429, 500, and 503 by default).
+func (pb *PolicyBuilder) RetryOn(statuses ...int) *PolicyBuilder {
+	return pb.RetryWhen(RetryableStatuses(statuses...))
+}
+
+// RetryWhen sets the StatusClassifier used to decide which status codes should be retried,
+// replacing the default of status codes classified as retryable by DefaultRetryableStatus (429,
+// 500, and 503 by default).
+func (pb *PolicyBuilder) RetryWhen(isRetryable StatusClassifier) *PolicyBuilder {
+	pb.isRetryable = isRetryable
+	return pb
+}
+
+// HonorRetryAfter honors Retry-After headers, when specified as either a duration in <seconds>
+// or as an <http-date>. Like IdiomaticRetryAfter, the header is honored even if the response
+// isn't retried.
+func (pb *PolicyBuilder) HonorRetryAfter() *PolicyBuilder {
+	pb.honorRetryAfter = true
+	return pb
+}
+
+// Backoff waits according to `b` before retrying, unless a Retry-After header (see
+// HonorRetryAfter) says otherwise.
+func (pb *PolicyBuilder) Backoff(b Backoff) *PolicyBuilder {
+	pb.backoff = &b
+	return pb
+}
+
+// MaxAttempts stops retrying once `n` attempts (including the first) have been made. Zero means
+// no limit.
+func (pb *PolicyBuilder) MaxAttempts(n int) *PolicyBuilder {
+	pb.maxAttempts = n
+	return pb
+}
+
+// Build returns the RetryAfterPolicy described by the builder.
+func (pb *PolicyBuilder) Build() RetryAfterPolicy {
+	built := *pb
+	if built.backoff != nil {
+		b := *built.backoff
+		built.backoff = &b
+	}
+
+	return built.policy
+}
+
+func (pb *PolicyBuilder) policy(
+	resp *http.Response,
+	prevResps ...*http.Response,
+) (retry bool, after time.Time) {
+
+	retry = pb.isRetryable(resp.StatusCode)
+
+	var d time.Duration
+	if pb.honorRetryAfter {
+		header := resp.Header.Get("Retry-After")
+		reportParseError(resp, "Retry-After", header, retryAfterParseError(header))
+		if d = retryAfterDuration(header); d != 0 {
+			after = tyme.Now().Add(d)
+		} else if after = retryAfterTime(header); !after.IsZero() {
+			d = tyme.Until(after)
+		}
+	}
+
+	if retry && after.IsZero() && pb.backoff != nil {
+		n := len(prevResps)
+		after = tyme.Now().Add(pb.backoff.Duration(n))
+		d = pb.backoff.exponential(uint64(n))
+	}
+
+	if pb.maxAttempts > 0 && len(prevResps)+1 >= pb.maxAttempts {
+		retry = false
+	}
+
+	retry = retry && (d < DefaultMaxRetryAfterDuration)
+	return retry, after
+}
+
+// ################################
+// ######### Combinators ##########
+// ################################
+
+// FirstOf returns a policy that consults each of `policies` in order, and returns the decision
+// of the first which either retries, or sets a non-zero `after`.
+func FirstOf(policies ...RetryAfterPolicy) RetryAfterPolicy {
+	return func(resp *http.Response, prevResps ...*http.Response) (bool, time.Time) {
+		for _, policy := range policies {
+			if retry, after := policy(resp, prevResps...); retry || !after.IsZero() {
+				return retry, after
+			}
+		}
+		return false, time.Time{}
+	}
+}
+
+// MaxOf returns a policy that consults all of `policies`. It retries if any of them retries, and
+// waits until the latest `after` of them all.
+func MaxOf(policies ...RetryAfterPolicy) RetryAfterPolicy {
+	return func(resp *http.Response, prevResps ...*http.Response) (retry bool, after time.Time) {
+		for _, policy := range policies {
+			r, a := policy(resp, prevResps...)
+			retry = retry || r
+			if a.After(after) {
+				after = a
+			}
+		}
+		return retry, after
+	}
+}
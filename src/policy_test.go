@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/testutils"
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyBuilderDefaults(t *testing.T) {
+	policy := NewPolicy().Build()
+
+	retry, after := policy(testutils.StubResponse(429, "", "Retry-After", "10"))
+	assert.True(t, retry)
+	assert.Zero(t, after) // Retry-After isn't honored unless asked
+
+	retry, after = policy(testutils.StubResponse(502, ""))
+	assert.False(t, retry)
+	assert.Zero(t, after)
+}
+
+func TestPolicyBuilder(t *testing.T) {
+	policy := NewPolicy().
+		RetryOn(429, 502, 503, 504).
+		HonorRetryAfter().
+		Backoff(Backoff{}).
+		MaxAttempts(3).
+		Build()
+
+	now := time.Now()
+	tyme.FreezeTimeAt(now, func() {
+		retry, after := policy(testutils.StubResponse(502, ""))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(1*time.Second), after)
+
+		retry, after = policy(testutils.StubResponse(504, ""), testutils.StubResponse(502, ""))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(2*time.Second), after)
+
+		retry, after = policy(testutils.StubResponse(429, "", "Retry-After", "10"))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(10*time.Second), after)
+
+		retry, _ = policy(testutils.StubResponse(500, ""))
+		assert.False(t, retry)
+
+		// the third attempt is the last
+		retry, _ = policy(
+			testutils.StubResponse(503, ""),
+			testutils.StubResponse(503, ""),
+			testutils.StubResponse(503, ""),
+		)
+		assert.False(t, retry)
+	})
+}
+
+func TestPolicyBuilderBuildIsolation(t *testing.T) {
+	builder := NewPolicy().RetryOn(418)
+	policy := builder.Build()
+	builder.RetryOn(500).MaxAttempts(1)
+
+	retry, _ := policy(testutils.StubResponse(418, ""))
+	assert.True(t, retry)
+}
+
+func TestFirstOf(t *testing.T) {
+	never := func(*http.Response, ...*http.Response) (bool, time.Time) {
+		return false, time.Time{}
+	}
+
+	now := time.Now()
+	tyme.FreezeTimeAt(now, func() {
+		policy := FirstOf(never, RetryAfterDurationInHeader, ExponentialBackoff)
+
+		retry, after := policy(testutils.StubResponse(429, "", "Retry-After", "10"))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(10*time.Second), after)
+
+		// RetryAfterDurationInHeader retries without a time, so ExponentialBackoff isn't consulted
+		retry, after = policy(testutils.StubResponse(429, ""))
+		assert.True(t, retry)
+		assert.Zero(t, after)
+
+		retry, after = FirstOf(never)(testutils.StubResponse(429, ""))
+		assert.False(t, retry)
+		assert.Zero(t, after)
+	})
+}
+
+func TestMaxOf(t *testing.T) {
+	now := time.Now()
+	tyme.FreezeTimeAt(now, func() {
+		policy := MaxOf(RetryAfterDurationInHeader, ExponentialBackoff)
+
+		retry, after := policy(testutils.StubResponse(429, "", "Retry-After", "10"))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(10*time.Second), after)
+
+		retry, after = policy(testutils.StubResponse(429, ""))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(1*time.Second), after)
+
+		retry, after = policy(testutils.StubResponse(200, ""))
+		assert.False(t, retry)
+		assert.Zero(t, after)
+	})
+}
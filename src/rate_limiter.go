@@ -1,13 +1,21 @@
 package ratelimit
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/gabehardgrave/ratelimit/src/internal/aychttp"
+	"github.com/gabehardgrave/ratelimit/src/internal/maath"
 	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
 )
 
+// DefaultMaxDrainBytes is the number of bytes read from retried responses before they're closed,
+// unless configured otherwise.
+const DefaultMaxDrainBytes = 64 << 10
+
 // RateLimiter provides a threadsafe API for self rate limiting applications.
 //
 // Internally, RateLimiter stores a time, `t`, after which it is safe for the application
@@ -16,20 +24,117 @@ import (
 // `t` can be updated either through `SetRetryAfterTime` or `SetRetryAfterDuration`, although
 // neither method will decrease `t`.
 //
-// In order to block (i.e. honor rate limits), applications must call `SleepUntilReady`. This will
-// block the calling goroutine until time `t`.
+// In order to block (i.e. honor rate limits), applications must call `SleepUntilReady` (or
+// `WaitContext`). This will block the calling goroutine until time `t`.
+//
+// RateLimiter can additionally enforce a client side budget (see `SetLimit` and
+// `SetAdaptiveLimit`), in which case `SleepUntilReady` also blocks until a token is available.
+// When used by Client, MultiHostClient, or Transport, quotas advertised by the server (see
+// RateLimitHeaders) are enforced as a budget too. The zero value imposes no budget.
 type RateLimiter struct {
-	t tyme.Atomic
+	t        tyme.Atomic
+	bucket   tokenBucket
+	quota    tokenBucket // the budget advertised by the server, e.g. via RateLimitHeaders
+	adaptive adaptiveRate
+	waiters  int32 // goroutines currently sleeping in SleepUntilReady or WaitContext
 }
 
 // SleepUntilReady will block the current goroutine until the rate limit has been honored,
-// based on prior calls to SetRetryAfterTime or SetRetryAfterDuration. SleepUntilReady() returns
-// the duration it slept for.
+// based on prior calls to SetRetryAfterTime or SetRetryAfterDuration, and until a token is
+// available under the limit set by SetLimit. SleepUntilReady() returns the duration it slept for.
 func (rl *RateLimiter) SleepUntilReady() (d time.Duration) {
-	d = rl.t.Time().Sub(tyme.Now())
+	now := tyme.Now()
+	d = rl.reserve(now).Sub(now)
+	defer rl.track(d)()
 	return tyme.Sleep(d)
 }
 
+// WaitContext is like SleepUntilReady, but returns early with ctx.Err() if ctx is cancelled
+// before the rate limit has been honored. If ctx has a deadline before `t`, WaitContext does not
+// sleep at all, and instead returns a *RetryAfterDeadlineError. WaitContext returns the duration
+// it slept for.
+func (rl *RateLimiter) WaitContext(ctx context.Context) (d time.Duration, err error) {
+	now := tyme.Now()
+	t := rl.reserve(now)
+	if deadline, ok := ctx.Deadline(); ok && t.After(deadline) {
+		rl.cancel()
+		return 0, &RetryAfterDeadlineError{RetryAfter: t, Deadline: deadline}
+	}
+
+	defer rl.track(t.Sub(now))()
+	d, err = tyme.SleepContext(ctx, t.Sub(now))
+	if err != nil {
+		rl.cancel()
+	}
+	return d, err
+}
+
+// ReadyAt returns the earliest time at which SleepUntilReady would return without sleeping, taking
+// into account both rate limits set by the server, and the client side budget. Times in the past
+// (including the zero time) mean the RateLimiter is ready now.
+func (rl *RateLimiter) ReadyAt() time.Time {
+	t := rl.t.Time()
+	from := later(tyme.Now(), t)
+	t = later(t, rl.bucket.readyAt(from))
+	return later(t, rl.quota.readyAt(from))
+}
+
+// IsThrottled reports whether requests must currently wait before being sent. See ReadyAt.
+func (rl *RateLimiter) IsThrottled() bool {
+	return rl.ReadyAt().After(tyme.Now())
+}
+
+// SetLimit sets the client side budget enforced by SleepUntilReady and WaitContext. The budget
+// applies in addition to any time set by SetRetryAfterTime or SetRetryAfterDuration. SetLimit
+// replaces any AdaptiveLimit.
+func (rl *RateLimiter) SetLimit(l Limit) {
+	now := tyme.Now()
+	rl.adaptive.configure(AdaptiveLimit{}, &rl.bucket, now)
+	rl.bucket.setLimit(l, now)
+}
+
+// SetAdaptiveLimit sets a client side budget which adapts to the responses observed by Client,
+// MultiHostClient, or Transport. SetAdaptiveLimit replaces any Limit, and calling it again with the
+// same AdaptiveLimit keeps the rate learned so far. A disabled AdaptiveLimit is the same as
+// SetLimit(Limit{}).
+func (rl *RateLimiter) SetAdaptiveLimit(a AdaptiveLimit) {
+	if !a.enabled() {
+		rl.SetLimit(Limit{})
+		return
+	}
+	rl.adaptive.configure(a, &rl.bucket, tyme.Now())
+}
+
+// Rate returns the rate, in requests per second, currently enforced by the RateLimiter's budget.
+// Under an AdaptiveLimit, this is the rate learned so far. Zero means no limit.
+func (rl *RateLimiter) Rate() float64 {
+	return rl.bucket.currentLimit().Rate
+}
+
+// track counts the calling goroutine as a waiter, if it's about to sleep for `d`, until the
+// returned func is called.
+func (rl *RateLimiter) track(d time.Duration) (done func()) {
+	if d <= 0 {
+		return func() {}
+	}
+	atomic.AddInt32(&rl.waiters, 1)
+	return func() { atomic.AddInt32(&rl.waiters, -1) }
+}
+
+// waiting returns the number of goroutines currently sleeping on the RateLimiter.
+func (rl *RateLimiter) waiting() int {
+	return int(atomic.LoadInt32(&rl.waiters))
+}
+
+// setBudget applies either `l`, or `a` if it's enabled.
+func (rl *RateLimiter) setBudget(l Limit, a AdaptiveLimit) {
+	if a.enabled() {
+		rl.SetAdaptiveLimit(a)
+	} else {
+		rl.SetLimit(l)
+	}
+}
+
 // SetRetryAfterTime updates `t` to max(`t`, `newT`). SetRetryAfterTime does not block the current
 // goroutine.
 func (rl *RateLimiter) SetRetryAfterTime(newT time.Time) {
@@ -43,43 +148,329 @@ func (rl *RateLimiter) SetRetryAfterDuration(d time.Duration) {
 	rl.SetRetryAfterTime(t)
 }
 
-// I'm not sure `do` really belongs here, but I wanted the logic to be reused by `Client` and
-// `MultiHostClient`, so this happened.
+// reserve returns the time after which it's safe to send a request, taking a token from each
+// bucket which imposes a budget. Tokens are reserved from the Retry-After time (if it's later than
+// now), so requests queued behind it stay spaced out once it passes, rather than all waking at
+// once.
+func (rl *RateLimiter) reserve(now time.Time) time.Time {
+	t := rl.t.Time()
+	from := later(now, t)
+	t = later(t, rl.bucket.reserve(from))
+	return later(t, rl.quota.reserve(from))
+}
+
+// cancel returns the tokens taken by `reserve`, e.g. when a request gave up waiting for them.
+func (rl *RateLimiter) cancel() {
+	rl.bucket.cancel()
+	rl.quota.cancel()
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// I'm not sure `do` really belongs here, but I wanted the logic to be reused by `Client`,
+// `MultiHostClient`, and `Transport`, so this happened.
+
+// sendFunc sends a single HTTP request. Both `http.Client.Do` and `http.RoundTripper.RoundTrip`
+// satisfy it.
+type sendFunc func(req *http.Request) (*http.Response, error)
+
+// doOptions is the configuration of `do`, as set on `Client`, `MultiHostClient`, or `Transport`.
+type doOptions struct {
+	policy             AttemptPolicy
+	errorPolicy        RetryErrorPolicy
+	maxRetries         int
+	maxTotalWait       time.Duration
+	retryNonIdempotent bool
+	autoIdempotencyKey bool
+
+	maxBufferedBodySize int64
+	bufferBodiesToDisk  bool
+
+	maxDrainBytes int64
+
+	sem            *semaphore
+	maxConcurrency int
+
+	key     string // the host (or other key) the RateLimiter belongs to
+	breaker *circuitBreaker
+	circuit CircuitBreaker
+
+	hooks  Hooks
+	logger Logger
+
+	statuses *recentStatuses
+}
+
+// exhausted reports whether retrying again would exceed the retry count or total wait limits.
+func (o *doOptions) exhausted(attempts []Attempt, nextWait time.Duration) bool {
+	if o.maxRetries > 0 && len(attempts) > o.maxRetries {
+		return true
+	}
+
+	if o.maxTotalWait > 0 {
+		total := nextWait
+		for _, a := range attempts {
+			total += a.Wait
+		}
+		return total > o.maxTotalWait
+	}
+
+	return false
+}
+
+// allow checks the circuit breaker, if there is one.
+func (o *doOptions) allow() (probe bool, err error) {
+	if o.breaker == nil {
+		return false, nil
+	}
+	probe, err = o.breaker.allow(o.circuit, tyme.Now())
+	if e, ok := err.(*CircuitOpenError); ok {
+		e.Host = o.key
+	}
+	return probe, err
+}
+
+// record updates the circuit breaker, if there is one.
+func (o *doOptions) record(probe bool, outcome circuitOutcome) {
+	if o.breaker != nil {
+		o.breaker.record(o.circuit, probe, outcome, tyme.Now())
+	}
+}
+
+// logAttempt logs the outcome of an attempt, and the policy's decision, followed by any headers
+// the policy couldn't parse.
+func (o *doOptions) logAttempt(ev HookEvent, after time.Time, parseErrs []headerParseError) {
+	args := []interface{}{"key", o.key, "attempt", ev.Attempt}
+	if ev.Err != nil {
+		args = append(args, "error", ev.Err)
+	} else {
+		args = append(args, "status", ev.StatusCode)
+	}
+	args = append(args, "duration", ev.Duration, "retry", ev.Retry)
+
+	retryAfter := ev.Header.Get("Retry-After")
+	if retryAfter != "" {
+		args = append(args, "retry_after", retryAfter)
+	}
+	if !after.IsZero() {
+		args = append(args, "until", after)
+	}
+	o.logger.Debug("ratelimit: attempt", args...)
+
+	for _, e := range parseErrs {
+		o.logger.Debug("ratelimit: ignoring unparseable header", "key", o.key,
+			"attempt", ev.Attempt, "header", e.header, "value", e.value, "error", e.err)
+	}
+}
+
+// circuitOutcomeOf classifies a sent request for the circuit breaker. Server errors and failures
+// to get a response count against the host, unless the caller gave up first.
+func circuitOutcomeOf(ctx context.Context, resp *http.Response, err error) circuitOutcome {
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return circuitAbandoned
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		return circuitFailed
+	default:
+		return circuitSucceeded
+	}
+}
 
 func (rl *RateLimiter) do(
 	req *http.Request,
-	client *http.Client,
-	policy RetryAfterPolicy,
-) (*http.Response, error) {
+	send sendFunc,
+	opts doOptions,
+) (resp *http.Response, err error) {
+
+	original := req
+	if opts.autoIdempotencyKey {
+		if req, err = withIdempotencyKey(req); err != nil {
+			return nil, err
+		}
+	}
 
-	var prevResps []*http.Response
 	includeBody := aychttp.HasBody(req)
+	if includeBody && req.GetBody == nil && opts.maxBufferedBodySize > 0 {
+		req = req.Clone(req.Context())
+		cleanup, err := aychttp.BufferBody(req, opts.maxBufferedBodySize, opts.bufferBodiesToDisk)
+		defer cleanup()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// OnAttemptStart may modify the request's headers, which must not leak into the caller's.
+	if req == original && opts.hooks.OnAttemptStart != nil {
+		req = req.Clone(req.Context())
+	}
+
+	// Policies report what else they learn from responses via the request's context.
+	report := &policyReport{}
+	req = req.WithContext(context.WithValue(req.Context(), policyReportKey{}, report))
+
+	var prevErrs []error
+	var attempts []Attempt
+	idempotent := opts.retryNonIdempotent || aychttp.IsIdempotent(req)
+	ctx := req.Context()
+
+	// event describes the current attempt to Hooks.
+	event := func() HookEvent {
+		return HookEvent{Request: req, Key: opts.key, Attempt: len(attempts) + 1}
+	}
+
+	call(opts.hooks.OnRequestStart, HookEvent{Request: req, Key: opts.key})
+	defer func() {
+		ev := HookEvent{Request: req, Key: opts.key, Attempt: len(attempts), Err: err}
+		if resp != nil {
+			ev.StatusCode, ev.Header = resp.StatusCode, resp.Header
+		}
+		call(opts.hooks.OnRequestEnd, ev)
+	}()
+	giveUp := func(resp *http.Response, err error) (*http.Response, error) {
+		ev := event()
+		ev.Attempt = len(attempts)
+		ev.Err = err
+		if resp != nil {
+			ev.StatusCode = resp.StatusCode
+			releaseEarly(resp.Body)
+		}
+		call(opts.hooks.OnGiveUp, ev)
+		debug(opts.logger, "ratelimit: giving up",
+			"key", opts.key, "attempts", ev.Attempt, "status", ev.StatusCode, "error", err)
+		return resp, err
+	}
 
 	for {
-		rl.SleepUntilReady()
+		probe, err := opts.allow()
+		if err != nil {
+			return giveUp(nil, err)
+		}
+
+		wait, err := rl.WaitContext(ctx)
+		if err != nil {
+			opts.record(probe, circuitAbandoned)
+			return giveUp(nil, err)
+		}
+		wait = maath.MaxDuration(wait, 0)
+		if wait > 0 {
+			ev := event()
+			ev.Wait = wait
+			call(opts.hooks.OnWait, ev)
+			debug(opts.logger, "ratelimit: waited", "key", opts.key, "attempt", ev.Attempt, "wait", wait)
+		}
 
-		resp, err := client.Do(req)
+		release, err := opts.sem.acquire(ctx, opts.maxConcurrency)
 		if err != nil {
-			return resp, err
+			opts.record(probe, circuitAbandoned)
+			return giveUp(nil, err)
 		}
 
-		retry, after := policy(resp, prevResps...)
+		ev := event()
+		ev.Wait = wait
+		call(opts.hooks.OnAttemptStart, ev)
+
+		start := tyme.Now()
+		resp, err := send(req)
+		if err != nil {
+			release()
+		} else if opts.maxConcurrency > 0 {
+			resp.Body = releaseOnClose(resp.Body, release)
+		}
+		opts.record(probe, circuitOutcomeOf(ctx, resp, err))
+		attempt := Attempt{
+			Wait:     wait,
+			Duration: tyme.Now().Sub(start),
+			Err:      err,
+		}
+		ev.Duration = attempt.Duration
+		ev.Err = err
+		if resp != nil {
+			opts.statuses.record(resp.StatusCode)
+		} else {
+			opts.statuses.record(0)
+		}
+
+		var retry bool
+		var after time.Time
+
+		if err != nil {
+			if ctx.Err() != nil {
+				call(opts.hooks.OnAttemptEnd, ev)
+				attempts = append(attempts, attempt)
+				return giveUp(resp, err) // no point retrying once the caller has given up
+			}
+			retry, after = opts.errorPolicy(err, prevErrs...)
+		} else {
+			attempt.StatusCode = resp.StatusCode
+			attempt.Header = resp.Header.Clone()
+			ev.StatusCode, ev.Header = resp.StatusCode, resp.Header
+			if resp.Request == nil {
+				resp.Request = req
+			}
+			retry, after = opts.policy(resp, attempts)
+		}
+
+		if retry && !idempotent {
+			retry = canRetryNonIdempotent(req, resp, err)
+		}
+		ev.Retry = retry
+		call(opts.hooks.OnAttemptEnd, ev)
+		parseErrs, quota := report.take()
+		if opts.logger != nil {
+			opts.logAttempt(ev, after, parseErrs)
+		}
+		attempts = append(attempts, attempt)
+
+		if quota != nil {
+			rl.quota.setLimit(*quota, tyme.Now())
+		}
+
+		if err == nil {
+			rl.adaptive.observe(start, resp.StatusCode, retry, &rl.bucket, tyme.Now())
+		}
 
 		if !after.IsZero() {
 			rl.SetRetryAfterTime(after)
 		}
 
 		if !retry {
-			return resp, err
+			if err != nil {
+				return giveUp(resp, err)
+			}
+			return resp, nil
+		}
+
+		nextWait := maath.MaxDuration(tyme.Until(rl.t.Time()), 0)
+		if opts.exhausted(attempts, nextWait) {
+			return giveUp(resp, &RetriesExhaustedError{Attempts: attempts})
 		}
 
-		_ = resp.Body.Close() // possible `policy` already closed the body.
-		prevResps = append(prevResps, resp)
+		if includeBody && req.GetBody == nil {
+			if err != nil {
+				return giveUp(resp, fmt.Errorf("%w: %v", ErrBodyNotReplayable, err))
+			}
+			return giveUp(resp, ErrBodyNotReplayable)
+		}
+
+		ev.Wait = nextWait
+		call(opts.hooks.OnRetryScheduled, ev)
+
+		if err != nil {
+			prevErrs = append(prevErrs, err)
+		} else {
+			// possible `policy` already closed the body.
+			_ = aychttp.DrainAndClose(resp.Body, opts.maxDrainBytes)
+		}
 
-		if includeBody && req.GetBody != nil {
+		if includeBody {
 			req.Body, err = req.GetBody()
 			if err != nil {
-				return resp, err
+				return giveUp(nil, err)
 			}
 		}
 	}
@@ -1,6 +1,7 @@
 package ratelimit
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -64,3 +65,138 @@ func TestRLRetryAfterTime(t *testing.T) {
 
 	assert.True(t, slept)
 }
+
+func TestRLWaitContext(t *testing.T) {
+	limiter := RateLimiter{}
+	now := time.Now()
+
+	slept := false
+	sleep := func(d time.Duration) {
+		slept = true
+		assert.Equal(t, 30*time.Minute, d)
+	}
+
+	tyme.FreezeTimeAt(now, func() {
+		limiter.SetRetryAfterTime(now.Add(30 * time.Minute))
+
+		tyme.StubSleep(sleep, func() {
+			d, err := limiter.WaitContext(context.Background())
+			assert.Nil(t, err)
+			assert.Equal(t, 30*time.Minute, d)
+		})
+	})
+
+	assert.True(t, slept)
+}
+
+func TestRLWaitContextCancelled(t *testing.T) {
+	limiter := RateLimiter{}
+	limiter.SetRetryAfterDuration(1 * time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := limiter.WaitContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 1*time.Minute)
+}
+
+func TestRLWaitContextPastDeadline(t *testing.T) {
+	limiter := RateLimiter{}
+	limiter.SetRetryAfterDuration(1 * time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	sleep := func(d time.Duration) {
+		assert.Fail(t, "WaitContext should not sleep past the deadline")
+	}
+
+	tyme.StubSleep(sleep, func() {
+		d, err := limiter.WaitContext(ctx)
+		assert.Zero(t, d)
+
+		var deadlineErr *RetryAfterDeadlineError
+		assert.ErrorAs(t, err, &deadlineErr)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestRLLimit(t *testing.T) {
+	limiter := RateLimiter{}
+	now := time.Now()
+
+	var sleeps []time.Duration
+	sleep := func(d time.Duration) {
+		if d < 0 {
+			d = 0
+		}
+		sleeps = append(sleeps, d)
+	}
+
+	tyme.FreezeTimeAt(now, func() {
+		limiter.SetLimit(Limit{Rate: 1, Burst: 2})
+
+		tyme.StubSleep(sleep, func() {
+			limiter.SleepUntilReady()
+			limiter.SleepUntilReady()
+			limiter.SleepUntilReady()
+			limiter.SleepUntilReady()
+		})
+	})
+
+	assert.Equal(t, []time.Duration{0, 0, 1 * time.Second, 2 * time.Second}, sleeps)
+}
+
+func TestRLLimitAndRetryAfter(t *testing.T) {
+	limiter := RateLimiter{}
+	now := time.Now()
+
+	var sleeps []time.Duration
+	sleep := func(d time.Duration) {
+		sleeps = append(sleeps, d)
+	}
+
+	tyme.FreezeTimeAt(now, func() {
+		limiter.SetLimit(Limit{Rate: 1, Burst: 1})
+		limiter.SetRetryAfterDuration(10 * time.Second)
+
+		tyme.StubSleep(sleep, func() {
+			limiter.SleepUntilReady() // the Retry-After time dominates
+			limiter.SleepUntilReady() // spaced out after the Retry-After time
+		})
+	})
+
+	tyme.FreezeTimeAt(now.Add(12*time.Second), func() {
+		tyme.StubSleep(sleep, func() {
+			limiter.SleepUntilReady() // the bucket has refilled by now
+		})
+	})
+
+	assert.Equal(t, []time.Duration{10 * time.Second, 11 * time.Second, 0}, sleeps)
+}
+
+func TestRLReadyAt(t *testing.T) {
+	limiter := RateLimiter{}
+	now := time.Now()
+
+	tyme.FreezeTimeAt(now, func() {
+		assert.False(t, limiter.IsThrottled())
+
+		limiter.SetLimit(Limit{Rate: 2, Burst: 1})
+		assert.Equal(t, now, limiter.ReadyAt())
+		assert.False(t, limiter.IsThrottled())
+
+		limiter.reserve(now)
+		assert.Equal(t, now.Add(500*time.Millisecond), limiter.ReadyAt())
+		assert.True(t, limiter.IsThrottled())
+
+		limiter.SetRetryAfterDuration(10 * time.Second)
+		assert.Equal(t, now.Add(10*time.Second), limiter.ReadyAt())
+	})
+
+	tyme.FreezeTimeAt(now.Add(10*time.Second), func() {
+		assert.False(t, limiter.IsThrottled())
+	})
+}
@@ -1,12 +1,12 @@
 package ratelimit
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/gabehardgrave/ratelimit/src/internal/aychttp"
-	"github.com/gabehardgrave/ratelimit/src/internal/maath"
 	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
 )
 
@@ -28,71 +28,56 @@ type RetryAfterPolicy func(
 // ################################
 
 // ExponentialBackoff implements a policy of exponential backoff. `retry` will be true if
-// `resp.StatusCode` is 429, 500, or 503. If `retry` is true, `after` will be calculated
-// as N seconds from `time.Now()`, where N starts at 1, and doubles for each response in
-// `prevResps`.
+// `resp.StatusCode` is classified as retryable by DefaultRetryableStatus (429, 500, and 503 by
+// default). If `retry` is true, `after` will be calculated as N seconds from `time.Now()`, where N
+// starts at 1, and doubles for each response in `prevResps`.
 func ExponentialBackoff(
 	resp *http.Response,
 	prevResps ...*http.Response,
 ) (retry bool, after time.Time) {
-
-	retry = aychttp.IsRetryable(resp)
-	if !retry {
-		return retry, after
-	}
-
-	dur := exponentialBackoffDuration(uint64(len(prevResps)))
-	after = tyme.Now().Add(dur)
-	retry = (dur < DefaultMaxRetryAfterDuration)
-
-	return retry, after
+	return exponentialBackoff(defaultRetryableStatus, Backoff{}, resp, prevResps)
 }
 
 var _ RetryAfterPolicy = ExponentialBackoff
 
+// ExponentialBackoffWith is like ExponentialBackoff, but waits according to `b`, allowing a
+// custom base, cap, and jitter. Regardless of the cap, `retry` becomes false once the uncapped
+// backoff would exceed DefaultMaxRetryAfterDuration.
+func ExponentialBackoffWith(b Backoff) RetryAfterPolicy {
+	return func(resp *http.Response, prevResps ...*http.Response) (bool, time.Time) {
+		return exponentialBackoff(defaultRetryableStatus, b, resp, prevResps)
+	}
+}
+
 // RetryAfterDurationInHeader implements a policy of honoring Retry-After headers, when specified
-// as duration in seconds. `retry` will be true if `resp.StatusCode` is 429, 500, or 503. If a
-// Retry-After header is present and set to N, `after` will be equivalent to
-// `time.Now().Add(N * time.Second)`.
+// as duration in seconds. `retry` will be true if `resp.StatusCode` is classified as retryable by
+// DefaultRetryableStatus (429, 500, and 503 by default). If a Retry-After header is present and set
+// to N, `after` will be equivalent to `time.Now().Add(N * time.Second)`.
 func RetryAfterDurationInHeader(
 	resp *http.Response,
 	prevResps ...*http.Response,
 ) (retry bool, after time.Time) {
-
-	dur := retryAfterDuration(resp.Header.Get("Retry-After"))
-	if dur > 0 {
-		after = tyme.Now().Add(dur)
-	}
-
-	retry = aychttp.IsRetryable(resp) &&
-		dur < DefaultMaxRetryAfterDuration
-
-	return retry, after
+	return retryAfterDurationInHeader(defaultRetryableStatus, resp)
 }
 
 var _ RetryAfterPolicy = RetryAfterDurationInHeader
 
 // RetryAfterTimeInHeader implements a policy of honoring Retry-After headers, when specified
-// as an <http-date>. `retry` will be true if `resp.StatusCode` is 429, 500, or 503. If a
-// Retry-After header is present and `after` will be the parsed time indicated by the <http-date>.
+// as an <http-date>. `retry` will be true if `resp.StatusCode` is classified as retryable by
+// DefaultRetryableStatus (429, 500, and 503 by default). If a Retry-After header is present and
+// `after` will be the parsed time indicated by the <http-date>.
 func RetryAfterTimeInHeader(
 	resp *http.Response,
 	prevResps ...*http.Response,
 ) (retry bool, after time.Time) {
-
-	after = retryAfterTime(resp.Header.Get("Retry-After"))
-
-	retry = aychttp.IsRetryable(resp) &&
-		after.Sub(tyme.Now()) < DefaultMaxRetryAfterDuration
-
-	return retry, after
+	return retryAfterTimeInHeader(defaultRetryableStatus, resp)
 }
 
 var _ RetryAfterPolicy = RetryAfterTimeInHeader
 
 // IdiomaticRetryAfter implements a policy of honoring Retry-After headers, when specified as
 // either a duration in <seconds>, or as an <http-date>. `retry` will be true if `resp.StatusCode`
-// is 429, 500, or 503.
+// is classified as retryable by DefaultRetryableStatus (429, 500, and 503 by default).
 //
 // If `retry` is true, but no `Retry-After` header was specified, IdiomaticRetryAfter implements
 // a policy of exponential backoff.
@@ -100,64 +85,552 @@ func IdiomaticRetryAfter(
 	resp *http.Response,
 	prevResps ...*http.Response,
 ) (retry bool, after time.Time) {
+	return idiomaticRetryAfter(defaultRetryableStatus, Backoff{}, resp, prevResps)
+}
 
-	retry = aychttp.IsRetryable(resp)
-	retryAfterStr := resp.Header.Get("Retry-After")
+var _ RetryAfterPolicy = IdiomaticRetryAfter
 
-	// It's possible for `Retry-After` to be specified, even if retry is false. Hence we only
-	// return early if retryAfterStr is unspecified.
-	if !retry && retryAfterStr == "" {
-		return retry, after
+// IdiomaticRetryAfterWith is like IdiomaticRetryAfter, but when no `Retry-After` header was
+// specified, waits according to `b`, allowing a custom base, cap, and jitter.
+func IdiomaticRetryAfterWith(b Backoff) RetryAfterPolicy {
+	return func(resp *http.Response, prevResps ...*http.Response) (bool, time.Time) {
+		return idiomaticRetryAfter(defaultRetryableStatus, b, resp, prevResps)
 	}
+}
 
-	d := retryAfterDuration(retryAfterStr)
-	if d != 0 {
-		after = tyme.Now().Add(d)
-	} else {
-		after = retryAfterTime(retryAfterStr)
-		d = tyme.Until(after)
+// XRateLimitHeaders implements IdiomaticRetryAfter, and additionally honors the non standard
+// `X-RateLimit-*` headers used by many APIs (GitHub, Twitter, Discord, etc).
+//
+// When `X-RateLimit-Remaining` (or `X-Rate-Limit-Remaining`) is 0, `after` will be the time
+// indicated by `X-RateLimit-Reset-After`, `X-RateLimit-Reset`, or `X-Rate-Limit-Reset`, even if
+// `retry` is false (e.g. for a 200 response that spent the last of the quota). A 429 response
+// without a remaining count is assumed to have exhausted its quota.
+//
+// `X-RateLimit-Reset` is ambiguous between APIs. Values large enough to be a recent unix
+// timestamp are treated as epoch seconds (or epoch milliseconds, if larger still). Smaller values
+// are treated as a number of seconds from now.
+func XRateLimitHeaders(
+	resp *http.Response,
+	prevResps ...*http.Response,
+) (retry bool, after time.Time) {
+
+	retry, after = IdiomaticRetryAfter(resp, prevResps...)
+
+	reset := xRateLimitReset(resp)
+	if reset.After(after) {
+		after = reset
+		retry = retry && tyme.Until(after) < DefaultMaxRetryAfterDuration
 	}
 
-	if retry && after.IsZero() {
-		d = exponentialBackoffDuration(uint64(len(prevResps)))
-		after = tyme.Now().Add(d)
+	return retry, after
+}
+
+var _ RetryAfterPolicy = XRateLimitHeaders
+
+// RateLimitHeaders implements IdiomaticRetryAfter, and additionally honors the `RateLimit`
+// headers described by the IETF httpapi working group. Both the older triple of
+// `RateLimit-Limit`, `RateLimit-Remaining`, and `RateLimit-Reset` headers, and the newer
+// structured field forms are understood, e.g.
+//
+//	RateLimit: limit=100, remaining=50, reset=30
+//	RateLimit: "default";r=50;t=30
+//	RateLimit-Policy: 100;w=60
+//	RateLimit-Policy: "default";q=100;w=60
+//
+// Rather than only reacting once the quota is exhausted, RateLimitHeaders paces requests. Client,
+// MultiHostClient, and Transport enforce the remaining quota as a budget (like Limit), spreading
+// requests evenly until the quota resets, however many are sent concurrently. When only a
+// `RateLimit-Policy` is known, requests are spaced by the policy's window divided by its quota.
+//
+// Once the quota is exhausted, `after` is the time it resets. `retry` is unaffected by these
+// headers.
+func RateLimitHeaders(
+	resp *http.Response,
+	prevResps ...*http.Response,
+) (retry bool, after time.Time) {
+
+	retry, after = IdiomaticRetryAfter(resp, prevResps...)
+
+	budget, exhaustedFor := rateLimitBudget(resp)
+	reportQuota(resp, budget)
+	if exhaustedFor > 0 {
+		if reset := tyme.Now().Add(exhaustedFor); reset.After(after) {
+			after = reset
+			retry = retry && exhaustedFor < DefaultMaxRetryAfterDuration
+		}
 	}
 
-	retry = retry && (d < DefaultMaxRetryAfterDuration)
 	return retry, after
 }
 
-var _ RetryAfterPolicy = IdiomaticRetryAfter
+var _ RetryAfterPolicy = RateLimitHeaders
 
 // ################################
 // ######### Private Shit #########
 // ################################
 
-func retryAfterTime(header string) (t time.Time) {
-	if header == "" { // quickly catch missing header
-		return t
+// A RetryAfterPolicy can only say whether, and when, to retry. The built-in policies report
+// anything else they learn from a response via the policyReport `do` attaches to the request's
+// context: headers they couldn't parse (which they otherwise ignore, as if they were missing), so
+// they at least show up in the logs, and quotas advertised by the server, to be enforced as a
+// budget.
+
+// policyReport collects what the policies learned from the latest response.
+type policyReport struct {
+	parseErrs []headerParseError
+	quota     *Limit // nil unless a policy reported one
+}
+
+type headerParseError struct {
+	header, value string
+	err           error
+}
+
+type policyReportKey struct{}
+
+func reportFor(resp *http.Response) (*policyReport, bool) {
+	if resp.Request == nil {
+		return nil, false
 	}
+	report, ok := resp.Request.Context().Value(policyReportKey{}).(*policyReport)
+	return report, ok
+}
 
-	t, err := http.ParseTime(header)
-	if err != nil {
-		return time.Time{}
+// reportParseError records that `value` of `header` couldn't be parsed, if `do` is collecting
+// reports for resp's request. A nil `err` is ignored.
+func reportParseError(resp *http.Response, header, value string, err error) {
+	if err == nil {
+		return
+	}
+	if report, ok := reportFor(resp); ok {
+		report.parseErrs = append(report.parseErrs,
+			headerParseError{header: header, value: value, err: err})
 	}
+}
+
+// reportQuota records the budget advertised by the server in resp, if `do` is collecting reports
+// for resp's request. A zero Limit means the server advertised none.
+func reportQuota(resp *http.Response, quota Limit) {
+	if report, ok := reportFor(resp); ok {
+		report.quota = &quota
+	}
+}
+
+// take returns what's been reported so far, and forgets it.
+func (r *policyReport) take() (parseErrs []headerParseError, quota *Limit) {
+	parseErrs, quota = r.parseErrs, r.quota
+	r.parseErrs, r.quota = nil, nil
+	return parseErrs, quota
+}
+
+func retryAfterTime(header string) (t time.Time) {
+	t, _ = parseRetryAfterTime(header)
 	return t
 }
 
 func retryAfterDuration(header string) (d time.Duration) {
+	d, _ = parseRetryAfterDuration(header)
+	return d
+}
+
+func parseRetryAfterTime(header string) (time.Time, error) {
+	if header == "" { // quickly catch missing header
+		return time.Time{}, nil
+	}
+	return http.ParseTime(header)
+}
+
+func parseRetryAfterDuration(header string) (time.Duration, error) {
 	if header == "" { // quickly catch missing header
-		return d
+		return 0, nil
 	}
 
 	seconds, err := strconv.ParseUint(header, 10, 64)
-	if err == nil {
-		d = time.Duration(seconds) * time.Second
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// retryAfterParseError returns an error if `header` is neither a number of seconds, nor an
+// http-date.
+func retryAfterParseError(header string) error {
+	if _, err := parseRetryAfterDuration(header); err == nil {
+		return nil
+	}
+	if _, err := parseRetryAfterTime(header); err != nil {
+		return fmt.Errorf("invalid Retry-After %q: want <seconds> or <http-date>", header)
+	}
+	return nil
+}
+
+const (
+	// Reset values at or above these thresholds are taken to be unix timestamps, rather than a
+	// number of seconds from now. 1e9 seconds is September 2001, and no API resets its quota 30
+	// years from now.
+	epochSecondsThreshold      = 1e9
+	epochMillisecondsThreshold = 1e12
+)
+
+func xRateLimitReset(resp *http.Response) (t time.Time) {
+	header, remaining := firstHeader(resp.Header, "X-RateLimit-Remaining", "X-Rate-Limit-Remaining")
+	exhausted := remaining == "" && resp.StatusCode == http.StatusTooManyRequests
+	if remaining != "" {
+		n, err := strconv.ParseFloat(remaining, 64)
+		reportParseError(resp, header, remaining, err)
+		exhausted = err == nil && n <= 0
+	}
+	if !exhausted {
+		return t
+	}
+
+	if resetAfter := resp.Header.Get("X-RateLimit-Reset-After"); resetAfter != "" {
+		seconds, err := strconv.ParseFloat(resetAfter, 64)
+		reportParseError(resp, "X-RateLimit-Reset-After", resetAfter, err)
+		if err != nil || seconds <= 0 {
+			return t
+		}
+		return tyme.Now().Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	header, reset := firstHeader(resp.Header, "X-RateLimit-Reset", "X-Rate-Limit-Reset")
+	if reset == "" {
+		return t
+	}
+
+	n, err := strconv.ParseFloat(reset, 64)
+	reportParseError(resp, header, reset, err)
+	if err != nil || n <= 0 {
+		return t
+	}
+
+	switch {
+	case n >= epochMillisecondsThreshold:
+		return time.Unix(0, int64(n)*int64(time.Millisecond))
+	case n >= epochSecondsThreshold:
+		return time.Unix(0, int64(n*float64(time.Second)))
+	default:
+		return tyme.Now().Add(time.Duration(n * float64(time.Second)))
 	}
-	return d
 }
 
-func exponentialBackoffDuration(prevReqCount uint64) time.Duration {
-	nSec := maath.MaxPowerOf2(prevReqCount)
-	return time.Duration(nSec) * time.Second
+// rateLimitQuota is a single quota parsed from `RateLimit` headers. Unknown values are negative.
+type rateLimitQuota struct {
+	limit     int64
+	remaining int64
+	reset     time.Duration
+	window    time.Duration
+}
+
+func unknownQuota() rateLimitQuota {
+	return rateLimitQuota{limit: -1, remaining: -1, reset: -1, window: -1}
+}
+
+// pacing returns how far apart requests must be spaced to stay within q or, if q is exhausted, how
+// long until it resets.
+func (q rateLimitQuota) pacing() (spacing, exhaustedFor time.Duration) {
+	reset := q.reset
+	if reset < 0 {
+		reset = q.window
+	}
+
+	switch {
+	case q.remaining == 0 && reset > 0:
+		return 0, reset
+	case q.remaining > 0 && reset > 0:
+		return reset / time.Duration(q.remaining), 0
+	case q.remaining < 0 && q.limit > 0 && q.window > 0:
+		return q.window / time.Duration(q.limit), 0
+	}
+	return 0, 0
+}
+
+// rateLimitBudget returns a budget which keeps within all the quotas described by the `RateLimit`
+// headers of resp, along with how long until the longest exhausted quota resets.
+func rateLimitBudget(resp *http.Response) (budget Limit, exhaustedFor time.Duration) {
+	quotas, policies := parseRateLimitHeaders(resp)
+
+	// The window of a quota may only be known from its policy. With several policies, there's no
+	// reliable way to tell which applies, so only a lone policy's window is borrowed.
+	if len(policies) == 1 {
+		for i := range quotas {
+			if quotas[i].window < 0 {
+				quotas[i].window = policies[0].window
+			}
+		}
+	}
+	if len(quotas) == 0 {
+		quotas = policies
+	}
+
+	var spacing time.Duration
+	for _, q := range quotas {
+		s, e := q.pacing()
+		if s > spacing {
+			spacing = s
+		}
+		if e > exhaustedFor {
+			exhaustedFor = e
+		}
+	}
+
+	if spacing > 0 {
+		budget = Limit{Rate: float64(time.Second) / float64(spacing), Burst: 1}
+	}
+	return budget, exhaustedFor
+}
+
+func parseRateLimitHeaders(resp *http.Response) (quotas, policies []rateLimitQuota) {
+	policy := rateLimitParser{resp: resp, header: "RateLimit-Policy"}
+	for _, item := range policy.list() {
+		q := unknownQuota()
+		q.limit = policy.param(item, "q", item.value)
+		q.window = policy.paramSeconds(item, "w")
+		policies = append(policies, q)
+	}
+
+	rateLimit := rateLimitParser{resp: resp, header: "RateLimit"}
+	items := rateLimit.list()
+	if len(items) > 0 && items[0].key != "" {
+		// The dictionary form, i.e. `limit=100, remaining=50, reset=30`, describes one quota.
+		q := unknownQuota()
+		for _, item := range items {
+			switch item.key {
+			case "limit":
+				q.limit = rateLimit.int(item.value)
+				q.window = rateLimit.paramSeconds(item, "w")
+			case "remaining":
+				q.remaining = rateLimit.int(item.value)
+			case "reset":
+				q.reset = rateLimit.seconds(item.value)
+			}
+		}
+		quotas = append(quotas, q)
+	} else {
+		for _, item := range items {
+			q := unknownQuota()
+			q.remaining = rateLimit.param(item, "r", "")
+			q.reset = rateLimit.paramSeconds(item, "t")
+			quotas = append(quotas, q)
+		}
+	}
+
+	// The older triple of headers.
+	limit := rateLimitParser{resp: resp, header: "RateLimit-Limit"}
+	remaining := rateLimitParser{resp: resp, header: "RateLimit-Remaining"}
+	reset := rateLimitParser{resp: resp, header: "RateLimit-Reset"}
+	if remaining.value() != "" || reset.value() != "" {
+		q := unknownQuota()
+		// e.g. `RateLimit-Limit: 100, 100;w=60`, where the first member is the current limit, and
+		// any others describe the policy.
+		for i, item := range limit.list() {
+			if i == 0 {
+				q.limit = limit.int(item.value)
+			}
+			if w := limit.paramSeconds(item, "w"); w >= 0 && q.window < 0 {
+				q.window = w
+			}
+		}
+		if items := remaining.list(); len(items) > 0 {
+			q.remaining = remaining.int(items[0].value)
+		}
+		if items := reset.list(); len(items) > 0 {
+			q.reset = reset.seconds(items[0].value)
+		}
+		quotas = append(quotas, q)
+	}
+
+	return quotas, policies
+}
+
+// rateLimitParser parses the values of a single `RateLimit` header, reporting any which should be,
+// but aren't, non-negative integers. Values which couldn't be parsed are -1.
+type rateLimitParser struct {
+	resp   *http.Response
+	header string
+}
+
+func (p rateLimitParser) value() string {
+	return p.resp.Header.Get(p.header)
+}
+
+func (p rateLimitParser) list() []structuredItem {
+	return parseStructuredList(p.value())
+}
+
+func (p rateLimitParser) int(s string) int64 {
+	n := parseStructuredInt(s)
+	if n < 0 && s != "" {
+		reportParseError(p.resp, p.header, p.value(),
+			fmt.Errorf("invalid %s: %q is not a non-negative integer", p.header, s))
+	}
+	return n
+}
+
+func (p rateLimitParser) seconds(s string) time.Duration {
+	n := p.int(s)
+	if n < 0 {
+		return -1
+	}
+	return time.Duration(n) * time.Second
+}
+
+// param parses the parameter `param` of item, or `fallback` if item doesn't have it.
+func (p rateLimitParser) param(item structuredItem, param string, fallback string) int64 {
+	if v, ok := item.params[param]; ok {
+		return p.int(v)
+	}
+	return p.int(fallback)
+}
+
+// paramSeconds parses the parameter `param` of item as a number of seconds, or returns -1 if item
+// doesn't have it.
+func (p rateLimitParser) paramSeconds(item structuredItem, param string) time.Duration {
+	v, ok := item.params[param]
+	if !ok {
+		return -1
+	}
+	return p.seconds(v)
+}
+
+// structuredItem is a (very forgiving) member of a structured field list or dictionary, as
+// described by RFC 8941. `key` is only set for dictionary members.
+type structuredItem struct {
+	key    string
+	value  string
+	params map[string]string
+}
+
+func parseStructuredList(header string) (items []structuredItem) {
+	if header == "" {
+		return items
+	}
+
+	for _, member := range strings.Split(header, ",") {
+		parts := strings.Split(member, ";")
+
+		item := structuredItem{params: make(map[string]string)}
+		item.value = strings.TrimSpace(parts[0])
+		if i := strings.IndexByte(item.value, '='); i >= 0 && !strings.HasPrefix(item.value, `"`) {
+			item.key = strings.TrimSpace(item.value[:i])
+			item.value = strings.TrimSpace(item.value[i+1:])
+		}
+		item.value = strings.Trim(item.value, `"`)
+
+		for _, param := range parts[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			item.params[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		}
+
+		items = append(items, item)
+	}
+	return items
+}
+
+func parseStructuredInt(s string) int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// firstHeader returns the first of `keys` present in h, along with its value.
+func firstHeader(h http.Header, keys ...string) (key, value string) {
+	for _, k := range keys {
+		if v := h.Get(k); v != "" {
+			return k, v
+		}
+	}
+	return "", ""
+}
+
+func retryAfterDurationInHeader(
+	isRetryable StatusClassifier,
+	resp *http.Response,
+) (retry bool, after time.Time) {
+
+	header := resp.Header.Get("Retry-After")
+	dur, err := parseRetryAfterDuration(header)
+	reportParseError(resp, "Retry-After", header, err)
+	if dur > 0 {
+		after = tyme.Now().Add(dur)
+	}
+
+	retry = isRetryable(resp.StatusCode) &&
+		dur < DefaultMaxRetryAfterDuration
+
+	return retry, after
+}
+
+func retryAfterTimeInHeader(
+	isRetryable StatusClassifier,
+	resp *http.Response,
+) (retry bool, after time.Time) {
+
+	header := resp.Header.Get("Retry-After")
+	after, err := parseRetryAfterTime(header)
+	reportParseError(resp, "Retry-After", header, err)
+
+	retry = isRetryable(resp.StatusCode) &&
+		after.Sub(tyme.Now()) < DefaultMaxRetryAfterDuration
+
+	return retry, after
+}
+
+func exponentialBackoff(
+	isRetryable StatusClassifier,
+	b Backoff,
+	resp *http.Response,
+	prevResps []*http.Response,
+) (retry bool, after time.Time) {
+
+	retry = isRetryable(resp.StatusCode)
+	if !retry {
+		return retry, after
+	}
+
+	n := len(prevResps)
+	after = tyme.Now().Add(b.Duration(n))
+	retry = (b.exponential(uint64(n)) < DefaultMaxRetryAfterDuration)
+
+	return retry, after
+}
+
+func idiomaticRetryAfter(
+	isRetryable StatusClassifier,
+	b Backoff,
+	resp *http.Response,
+	prevResps []*http.Response,
+) (retry bool, after time.Time) {
+
+	retry = isRetryable(resp.StatusCode)
+	retryAfterStr := resp.Header.Get("Retry-After")
+
+	// It's possible for `Retry-After` to be specified, even if retry is false. Hence we only
+	// return early if retryAfterStr is unspecified.
+	if !retry && retryAfterStr == "" {
+		return retry, after
+	}
+	reportParseError(resp, "Retry-After", retryAfterStr, retryAfterParseError(retryAfterStr))
+
+	d := retryAfterDuration(retryAfterStr)
+	if d != 0 {
+		after = tyme.Now().Add(d)
+	} else {
+		after = retryAfterTime(retryAfterStr)
+		d = tyme.Until(after)
+	}
+
+	if retry && after.IsZero() {
+		n := len(prevResps)
+		after = tyme.Now().Add(b.Duration(n))
+		d = b.exponential(uint64(n)) // the cap and jitter don't change when to give up
+	}
+
+	retry = retry && (d < DefaultMaxRetryAfterDuration)
+	return retry, after
 }
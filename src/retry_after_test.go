@@ -85,3 +85,122 @@ func TestRetryAfterTimeInHeader(t *testing.T) {
 	assert.True(t, retry)
 	assert.Equal(t, after, time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC))
 }
+
+func TestXRateLimitHeaders(t *testing.T) {
+	now := time.Now()
+
+	tyme.FreezeTimeAt(now, func() {
+		// quota remaining, nothing to do
+		retry, after := XRateLimitHeaders(testutils.StubResponse(200, "",
+			"X-RateLimit-Remaining", "10", "X-RateLimit-Reset", "30"))
+		assert.False(t, retry)
+		assert.Zero(t, after)
+
+		// quota exhausted on a successful response, as a delta in seconds
+		retry, after = XRateLimitHeaders(testutils.StubResponse(200, "",
+			"X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "30"))
+		assert.False(t, retry)
+		assert.EqualValues(t, now.Add(30*time.Second), after)
+
+		// quota exhausted, as epoch seconds
+		reset := now.Add(1 * time.Minute).Truncate(time.Second)
+		retry, after = XRateLimitHeaders(testutils.StubResponse(429, "",
+			"X-Rate-Limit-Remaining", "0",
+			"X-Rate-Limit-Reset", strconv.FormatInt(reset.Unix(), 10)))
+		assert.True(t, retry)
+		assert.True(t, reset.Equal(after))
+
+		// quota exhausted, as epoch milliseconds
+		retry, after = XRateLimitHeaders(testutils.StubResponse(429, "",
+			"X-RateLimit-Reset", strconv.FormatInt(reset.UnixNano()/int64(time.Millisecond), 10)))
+		assert.True(t, retry)
+		assert.True(t, reset.Equal(after))
+
+		// Reset-After takes precedence, and may be fractional
+		retry, after = XRateLimitHeaders(testutils.StubResponse(429, "",
+			"X-RateLimit-Remaining", "0",
+			"X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10),
+			"X-RateLimit-Reset-After", "1.5"))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(1500*time.Millisecond), after)
+
+		// Retry-After wins if it's later
+		retry, after = XRateLimitHeaders(testutils.StubResponse(429, "",
+			"Retry-After", "120",
+			"X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "30"))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(120*time.Second), after)
+	})
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		name    string
+		headers []string
+		rate    float64       // of the budget reported to `do`
+		wait    time.Duration // until the exhausted quota resets
+	}{
+		{"no headers", nil, 0, 0},
+		{"triple", []string{
+			"RateLimit-Limit", "100", "RateLimit-Remaining", "50", "RateLimit-Reset", "30",
+		}, 50.0 / 30, 0},
+		{"triple exhausted", []string{
+			"RateLimit-Limit", "100", "RateLimit-Remaining", "0", "RateLimit-Reset", "30",
+		}, 0, 30 * time.Second},
+		{"triple with window", []string{
+			"RateLimit-Limit", "100, 100;w=60", "RateLimit-Remaining", "0",
+		}, 0, 60 * time.Second},
+		{"dictionary", []string{
+			"RateLimit", "limit=100, remaining=10, reset=30",
+		}, 10.0 / 30, 0},
+		{"items", []string{
+			"RateLimit", `"default";r=0;t=12`,
+		}, 0, 12 * time.Second},
+		{"items take the slowest rate", []string{
+			"RateLimit", `"burst";r=10;t=1, "hourly";r=100;t=3600`,
+		}, 100.0 / 3600, 0},
+		{"items take the longest reset", []string{
+			"RateLimit", `"burst";r=10;t=1, "daily";r=0;t=3600`,
+		}, 10, 1 * time.Hour},
+		{"items borrow the policy window", []string{
+			"RateLimit", `"default";r=0`,
+			"RateLimit-Policy", `"default";q=100;w=60`,
+		}, 0, 60 * time.Second},
+		{"policy only", []string{
+			"RateLimit-Policy", "100;w=60",
+		}, 100.0 / 60, 0},
+	}
+
+	for _, c := range cases {
+		tyme.FreezeTimeAt(now, func() {
+			resp := testutils.StubResponse(200, "", c.headers...)
+			budget, _ := rateLimitBudget(resp)
+			assert.InDelta(t, c.rate, budget.Rate, 1e-9, c.name)
+
+			retry, after := RateLimitHeaders(resp)
+			assert.False(t, retry, c.name)
+			if c.wait == 0 {
+				assert.Zero(t, after, c.name)
+			} else {
+				assert.EqualValues(t, now.Add(c.wait), after, c.name)
+			}
+		})
+	}
+
+	tyme.FreezeTimeAt(now, func() {
+		retry, after := RateLimitHeaders(testutils.StubResponse(429, "",
+			"RateLimit", "limit=100, remaining=0, reset=30"))
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(30*time.Second), after)
+	})
+}
+
+func TestRetryAfterParseError(t *testing.T) {
+	assert.Nil(t, retryAfterParseError(""))
+	assert.Nil(t, retryAfterParseError("120"))
+	assert.Nil(t, retryAfterParseError("Wed, 21 Oct 2015 07:28:00 GMT"))
+	assert.NotNil(t, retryAfterParseError("-1"))
+	assert.NotNil(t, retryAfterParseError("2 minutes"))
+}
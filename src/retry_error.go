@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+)
+
+// RetryErrorPolicy describes the retry policy for requests that failed without a response (e.g.
+// connection resets, timeouts, or DNS failures). RetryErrorPolicy should return true if err
+// warrants a retry, and a non-zero time if requests should retry after a specific time.
+//
+// `prevErrs` holds the errors of previous failed attempts at the same request. Requests are never
+// retried once their context is done, regardless of the RetryErrorPolicy.
+type RetryErrorPolicy func(err error, prevErrs ...error) (retry bool, after time.Time)
+
+// RetryTransientErrors implements a policy of retrying errors classified as transient by
+// IsTransientError, with exponential backoff.
+func RetryTransientErrors(err error, prevErrs ...error) (retry bool, after time.Time) {
+	return retryTransientErrors(Backoff{}, err, prevErrs)
+}
+
+var _ RetryErrorPolicy = RetryTransientErrors
+
+// RetryTransientErrorsWith is like RetryTransientErrors, but waits according to `b`.
+func RetryTransientErrorsWith(b Backoff) RetryErrorPolicy {
+	return func(err error, prevErrs ...error) (bool, time.Time) {
+		return retryTransientErrors(b, err, prevErrs)
+	}
+}
+
+// NeverRetryErrors implements a policy of never retrying failed requests.
+func NeverRetryErrors(err error, prevErrs ...error) (retry bool, after time.Time) {
+	return false, after
+}
+
+var _ RetryErrorPolicy = NeverRetryErrors
+
+// IsTransientError reports whether err is likely to succeed if retried, e.g. connection resets,
+// unexpected EOFs, timeouts (including TLS handshake timeouts), and temporary DNS failures.
+//
+// Cancellation is never transient. IsTransientError can't tell a request's context deadline apart
+// from other timeouts, but requests are never retried once their context is done anyway.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// ################################
+// ######### Private Shit #########
+// ################################
+
+func retryTransientErrors(b Backoff, err error, prevErrs []error) (retry bool, after time.Time) {
+	retry = IsTransientError(err)
+	if !retry {
+		return retry, after
+	}
+
+	n := len(prevErrs)
+	after = tyme.Now().Add(b.Duration(n))
+	retry = (b.exponential(uint64(n)) < DefaultMaxRetryAfterDuration)
+
+	return retry, after
+}
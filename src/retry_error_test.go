@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransientError(t *testing.T) {
+	wrap := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://server.io", Err: err}
+	}
+
+	transient := []error{
+		io.ErrUnexpectedEOF,
+		wrap(io.EOF),
+		wrap(&net.OpError{Op: "read", Err: syscall.ECONNRESET}),
+		wrap(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}),
+		wrap(timeoutError{}),
+		wrap(&net.DNSError{Err: "server misbehaving", IsTemporary: true}),
+	}
+	for _, err := range transient {
+		assert.True(t, IsTransientError(err), err)
+	}
+
+	permanent := []error{
+		nil,
+		errors.New("unsupported protocol scheme"),
+		wrap(context.Canceled),
+		wrap(&net.DNSError{Err: "no such host", IsNotFound: true}),
+		fmt.Errorf("x509: certificate signed by unknown authority"),
+	}
+	for _, err := range permanent {
+		assert.False(t, IsTransientError(err), err)
+	}
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	now := time.Now()
+	tyme.FreezeTimeAt(now, func() {
+		retry, after := RetryTransientErrors(io.ErrUnexpectedEOF)
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(1*time.Second), after)
+
+		retry, after = RetryTransientErrors(io.ErrUnexpectedEOF, io.EOF, io.EOF)
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(4*time.Second), after)
+
+		retry, after = RetryTransientErrors(context.Canceled)
+		assert.False(t, retry)
+		assert.Zero(t, after)
+
+		retry, after = RetryTransientErrorsWith(Backoff{Base: time.Millisecond})(io.EOF)
+		assert.True(t, retry)
+		assert.EqualValues(t, now.Add(1*time.Millisecond), after)
+	})
+}
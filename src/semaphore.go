@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"sync"
+)
+
+// semaphore is a context aware counting semaphore, limiting the number of requests in flight.
+// Waiters acquire the semaphore in FIFO order.
+//
+// The limit is passed to each call, rather than stored, so that it can follow the configuration
+// of the owning Client. The zero value is ready to use.
+type semaphore struct {
+	lock    sync.Mutex
+	inUse   int
+	waiters list.List // of chan struct{}
+}
+
+// acquire blocks until fewer than `limit` requests are in flight, or until ctx is done. `release`
+// must be called once the request is complete. A limit of zero (or less) means no limit.
+func (s *semaphore) acquire(ctx context.Context, limit int) (release func(), err error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	s.lock.Lock()
+	if s.inUse < limit && s.waiters.Len() == 0 {
+		s.inUse++
+		s.lock.Unlock()
+		return s.releaser(limit), nil
+	}
+
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(ready)
+	s.lock.Unlock()
+
+	select {
+	case <-ready:
+		return s.releaser(limit), nil
+	case <-ctx.Done():
+	}
+
+	s.lock.Lock()
+	select {
+	case <-ready:
+		// We were granted the semaphore just as ctx was done. Pass it on to the next waiter.
+		s.inUse--
+	default:
+		s.waiters.Remove(elem)
+	}
+	s.grant(limit)
+	s.lock.Unlock()
+
+	return nil, ctx.Err()
+}
+
+// waiting returns the number of requests waiting to acquire the semaphore.
+func (s *semaphore) waiting() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.waiters.Len()
+}
+
+func (s *semaphore) releaser(limit int) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.lock.Lock()
+			s.inUse--
+			s.grant(limit)
+			s.lock.Unlock()
+		})
+	}
+}
+
+// grant hands the semaphore to as many waiters as the limit allows. Callers must hold s.lock.
+func (s *semaphore) grant(limit int) {
+	for s.inUse < limit && s.waiters.Len() > 0 {
+		ready := s.waiters.Remove(s.waiters.Front()).(chan struct{})
+		s.inUse++
+		close(ready)
+	}
+}
+
+// releasingBody releases a semaphore once the response body is closed, since the request is in
+// flight until then.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// releasingReadWriteBody is a releasingBody which stays writable, as the bodies of 101 Switching
+// Protocols responses must be.
+type releasingReadWriteBody struct {
+	*releasingBody
+	io.Writer
+}
+
+// releaseOnClose wraps body so that `release` is called once it's closed.
+func releaseOnClose(body io.ReadCloser, release func()) io.ReadCloser {
+	rb := &releasingBody{body, release}
+	if w, ok := body.(io.Writer); ok {
+		return &releasingReadWriteBody{rb, w}
+	}
+	return rb
+}
+
+// releaseEarly releases the semaphore held by body (if any) without closing it, for responses
+// returned alongside an error, which callers are allowed to ignore.
+func releaseEarly(body io.ReadCloser) {
+	switch b := body.(type) {
+	case *releasingBody:
+		b.release()
+	case *releasingReadWriteBody:
+		b.release()
+	}
+}
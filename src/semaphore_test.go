@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemaphoreNoLimit(t *testing.T) {
+	s := semaphore{}
+	for i := 0; i < 100; i++ {
+		_, err := s.acquire(context.Background(), 0)
+		assert.Nil(t, err)
+	}
+}
+
+func TestSemaphoreFIFO(t *testing.T) {
+	s := semaphore{}
+	ctx := context.Background()
+
+	release, err := s.acquire(ctx, 1)
+	assert.Nil(t, err)
+
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			release, _ := s.acquire(ctx, 1)
+			order <- i
+			release()
+		}(i)
+		waitForWaiters(&s, i+1)
+	}
+
+	release()
+	release() // releasing twice has no effect
+
+	assert.Equal(t, 0, <-order)
+	assert.Equal(t, 1, <-order)
+	assert.Equal(t, 2, <-order)
+}
+
+func TestSemaphoreContextCancelled(t *testing.T) {
+	s := semaphore{}
+	release, _ := s.acquire(context.Background(), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := s.acquire(ctx, 1)
+		errs <- err
+	}()
+	waitForWaiters(&s, 1)
+
+	acquired := make(chan struct{})
+	go func() {
+		release, _ := s.acquire(context.Background(), 1)
+		release()
+		close(acquired)
+	}()
+	waitForWaiters(&s, 2)
+
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+
+	// the cancelled waiter gave up its place in line
+	release()
+	<-acquired
+	assert.Equal(t, 0, s.inUse)
+}
+
+func waitForWaiters(s *semaphore, n int) {
+	for {
+		s.lock.Lock()
+		waiting := s.waiters.Len()
+		s.lock.Unlock()
+		if waiting >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limit describes a client side request budget, enforced by RateLimiter as a token bucket. The
+// bucket holds up to Burst tokens, and refills at Rate tokens per second. Each request consumes a
+// single token, and waits if none are available.
+//
+// The zero value imposes no limit.
+type Limit struct {
+
+	// Rate is the number of requests allowed per second. A Rate of zero (or less) disables the
+	// limit.
+	Rate float64
+
+	// Burst is the maximum number of requests that may be sent at once. Burst is treated as 1 if
+	// it is less than 1.
+	Burst int
+}
+
+func (l Limit) burst() float64 {
+	if l.Burst < 1 {
+		return 1
+	}
+	return float64(l.Burst)
+}
+
+// ################################
+// ##### private bucket stuff #####
+// ################################
+
+type tokenBucket struct {
+	lock   sync.Mutex
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) setLimit(l Limit, now time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if l == b.limit {
+		return
+	}
+
+	if b.limit.Rate <= 0 {
+		b.last = time.Time{} // start with a full bucket
+	} else {
+		b.advance(now)
+	}
+
+	b.limit = l
+	if b.tokens > l.burst() {
+		b.tokens = l.burst()
+	}
+}
+
+func (b *tokenBucket) currentLimit() Limit {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.limit
+}
+
+// reserve takes a token from the bucket, returning the time at which the token may be used. The
+// zero time is returned when the bucket imposes no limit. `now` may be in the future, for
+// reservations which can't be used before then anyway.
+func (b *tokenBucket) reserve(now time.Time) (at time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.limit.Rate <= 0 {
+		return at
+	}
+
+	b.advance(now)
+	from := b.from(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return from
+	}
+
+	wait := time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+	return from.Add(wait)
+}
+
+// readyAt returns the time at which a token will next be available, without taking it. The zero
+// time is returned when the bucket imposes no limit.
+func (b *tokenBucket) readyAt(now time.Time) (at time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.limit.Rate <= 0 {
+		return at
+	}
+
+	b.advance(now)
+	from := b.from(now)
+	if b.tokens >= 1 {
+		return from
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+	return from.Add(wait)
+}
+
+// cancel returns a reserved token to the bucket, e.g. when a request gave up waiting for it.
+func (b *tokenBucket) cancel() {
+	b.lock.Lock()
+	if b.limit.Rate > 0 && b.tokens < b.limit.burst() {
+		b.tokens++
+	}
+	b.lock.Unlock()
+}
+
+// from returns the time the bucket's tokens are counted from: usually `now`, but later if tokens
+// were last reserved from a future time (see RateLimiter.reserve). Callers must hold b.lock.
+func (b *tokenBucket) from(now time.Time) time.Time {
+	if b.last.After(now) {
+		return b.last
+	}
+	return now
+}
+
+// advance refills the bucket with the tokens accumulated since the last call. Callers must hold
+// b.lock.
+func (b *tokenBucket) advance(now time.Time) {
+	if b.last.IsZero() {
+		b.tokens = b.limit.burst()
+		b.last = now
+		return
+	}
+
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens += elapsed.Seconds() * b.limit.Rate
+	if b.tokens > b.limit.burst() {
+		b.tokens = b.limit.burst()
+	}
+	b.last = now
+}
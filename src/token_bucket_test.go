@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucketNoLimit(t *testing.T) {
+	b := tokenBucket{}
+	assert.Zero(t, b.reserve(time.Now()))
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	b := tokenBucket{}
+	now := time.Now()
+	b.setLimit(Limit{Rate: 10, Burst: 2}, now)
+
+	assert.Equal(t, now, b.reserve(now))
+	assert.Equal(t, now, b.reserve(now))
+	assert.Equal(t, now.Add(100*time.Millisecond), b.reserve(now))
+
+	later := now.Add(1 * time.Second)
+	assert.Equal(t, later, b.reserve(later))
+	assert.Equal(t, later, b.reserve(later))
+	assert.Equal(t, later.Add(100*time.Millisecond), b.reserve(later))
+}
+
+func TestTokenBucketCancel(t *testing.T) {
+	b := tokenBucket{}
+	now := time.Now()
+	b.setLimit(Limit{Rate: 1, Burst: 1}, now)
+
+	assert.Equal(t, now, b.reserve(now))
+	assert.Equal(t, now.Add(1*time.Second), b.reserve(now))
+	b.cancel()
+	assert.Equal(t, now.Add(1*time.Second), b.reserve(now))
+}
+
+func TestTokenBucketReservesFromTheFuture(t *testing.T) {
+	b := tokenBucket{}
+	now := time.Now()
+	later := now.Add(10 * time.Second)
+	b.setLimit(Limit{Rate: 1, Burst: 1}, now)
+
+	assert.Equal(t, now, b.reserve(now))
+	assert.Equal(t, later, b.reserve(later))
+	// tokens are counted from `later`, even when reserved from `now`
+	assert.Equal(t, later.Add(1*time.Second), b.reserve(now))
+	assert.Equal(t, later.Add(2*time.Second), b.readyAt(now))
+}
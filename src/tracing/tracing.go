@@ -0,0 +1,281 @@
+// Package tracing records OpenTelemetry style spans from a ratelimit client's Hooks: one span per
+// request, with a child span for each attempt, and for each wait on rate limits. Trace context is
+// propagated to the server on every attempt via the W3C traceparent header.
+//
+//	exporter := &tracing.InMemoryExporter{}
+//	tracer := &tracing.Tracer{Exporter: exporter}
+//	client := ratelimit.Client{Options: ratelimit.Options{Hooks: tracer.Hooks()}}
+//
+// Spans are handed to an Exporter as they end. To bridge into a tracing SDK, implement Exporter.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	ratelimit "github.com/gabehardgrave/ratelimit/src"
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+)
+
+// TraceParentHeader is the W3C Trace Context header used to propagate spans.
+const TraceParentHeader = "Traceparent"
+
+// Span names.
+const (
+	RequestSpan = "ratelimit.request"
+	AttemptSpan = "ratelimit.attempt"
+	WaitSpan    = "ratelimit.wait"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Span is a completed span.
+type Span struct {
+	Name     string
+	TraceID  TraceID
+	SpanID   SpanID
+	ParentID SpanID // zero for root spans
+	Start    time.Time
+	End      time.Time
+
+	// Attributes annotate the span, using OpenTelemetry's semantic conventions where they exist
+	// (e.g. "http.response.status_code").
+	Attributes map[string]interface{}
+
+	// Err is the error the span failed with, if any.
+	Err error
+}
+
+// Exporter receives spans as they end.
+type Exporter interface {
+	Export(span Span)
+}
+
+// InMemoryExporter keeps every span it receives, for tests. The zero value is ready to use.
+type InMemoryExporter struct {
+	lock  sync.Mutex
+	spans []Span
+}
+
+// Export implements Exporter.
+func (e *InMemoryExporter) Export(span Span) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns every span received so far, in the order they ended.
+func (e *InMemoryExporter) Spans() []Span {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]Span(nil), e.spans...)
+}
+
+// Reset discards every span received so far.
+func (e *InMemoryExporter) Reset() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = nil
+}
+
+// Tracer creates spans from a client's Hooks. If the request already carries a traceparent header
+// (e.g. set by the application's own tracing), the request span joins that trace as a child.
+type Tracer struct {
+
+	// Exporter receives spans as they end. If Exporter is nil, spans are discarded.
+	Exporter Exporter
+
+	requests sync.Map // of *http.Request to *requestTrace
+}
+
+// Hooks returns the Hooks which feed the Tracer. Set them on a Client, MultiHostClient, or
+// Transport, or combine them with other Hooks (e.g. a metrics.Collector's) using
+// ratelimit.JoinHooks.
+func (t *Tracer) Hooks() ratelimit.Hooks {
+	return ratelimit.Hooks{
+		OnRequestStart: t.requestStart,
+		OnRequestEnd:   t.requestEnd,
+		OnWait:         t.wait,
+		OnAttemptStart: t.attemptStart,
+		OnAttemptEnd:   t.attemptEnd,
+	}
+}
+
+// ###############################
+// #### private tracing stuff ####
+// ###############################
+
+// requestTrace holds the open spans of a single request. Events for a request all come from the
+// goroutine making it, so it needs no lock of its own.
+type requestTrace struct {
+	span    Span
+	attempt Span
+}
+
+func (t *Tracer) requestStart(ev ratelimit.HookEvent) {
+	span := Span{
+		Name:    RequestSpan,
+		TraceID: newTraceID(),
+		SpanID:  newSpanID(),
+		Start:   tyme.Now(),
+		Attributes: map[string]interface{}{
+			"http.request.method": method(ev.Request),
+			"url.full":            ev.Request.URL.String(),
+			"ratelimit.key":       ev.Key,
+		},
+	}
+	if traceID, parentID, ok := parseTraceParent(ev.Request.Header.Get(TraceParentHeader)); ok {
+		span.TraceID, span.ParentID = traceID, parentID
+	}
+	t.requests.Store(ev.Request, &requestTrace{span: span})
+}
+
+func (t *Tracer) requestEnd(ev ratelimit.HookEvent) {
+	v, ok := t.requests.LoadAndDelete(ev.Request)
+	if !ok {
+		return
+	}
+	rt := v.(*requestTrace)
+
+	rt.span.End = tyme.Now()
+	rt.span.Err = ev.Err
+	rt.span.Attributes["ratelimit.attempts"] = ev.Attempt
+	if ev.StatusCode != 0 {
+		rt.span.Attributes["http.response.status_code"] = ev.StatusCode
+	}
+	t.export(rt.span)
+}
+
+func (t *Tracer) wait(ev ratelimit.HookEvent) {
+	rt, ok := t.trace(ev.Request)
+	if !ok {
+		return
+	}
+
+	end := tyme.Now()
+	t.export(Span{
+		Name:     WaitSpan,
+		TraceID:  rt.span.TraceID,
+		SpanID:   newSpanID(),
+		ParentID: rt.span.SpanID,
+		Start:    end.Add(-ev.Wait),
+		End:      end,
+		Attributes: map[string]interface{}{
+			"ratelimit.attempt": ev.Attempt,
+			"ratelimit.wait":    ev.Wait.String(),
+		},
+	})
+}
+
+func (t *Tracer) attemptStart(ev ratelimit.HookEvent) {
+	rt, ok := t.trace(ev.Request)
+	if !ok {
+		return
+	}
+
+	rt.attempt = Span{
+		Name:     AttemptSpan,
+		TraceID:  rt.span.TraceID,
+		SpanID:   newSpanID(),
+		ParentID: rt.span.SpanID,
+		Start:    tyme.Now(),
+		Attributes: map[string]interface{}{
+			"ratelimit.attempt": ev.Attempt,
+		},
+	}
+	ev.Request.Header.Set(TraceParentHeader, formatTraceParent(rt.attempt.TraceID, rt.attempt.SpanID))
+}
+
+func (t *Tracer) attemptEnd(ev ratelimit.HookEvent) {
+	rt, ok := t.trace(ev.Request)
+	if !ok {
+		return
+	}
+
+	span := rt.attempt
+	span.End = tyme.Now()
+	span.Err = ev.Err
+	span.Attributes["ratelimit.retry"] = ev.Retry
+	if ev.StatusCode != 0 {
+		span.Attributes["http.response.status_code"] = ev.StatusCode
+	}
+	if retryAfter := ev.Header.Get("Retry-After"); retryAfter != "" {
+		span.Attributes["http.response.header.retry-after"] = retryAfter
+	}
+	t.export(span)
+}
+
+func (t *Tracer) trace(req *http.Request) (*requestTrace, bool) {
+	v, ok := t.requests.Load(req)
+	if !ok {
+		return nil, false
+	}
+	return v.(*requestTrace), true
+}
+
+func (t *Tracer) export(span Span) {
+	if t.Exporter != nil {
+		t.Exporter.Export(span)
+	}
+}
+
+func method(req *http.Request) string {
+	if req.Method == "" {
+		return http.MethodGet
+	}
+	return req.Method
+}
+
+func newTraceID() (id TraceID) {
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func newSpanID() (id SpanID) {
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// formatTraceParent formats a version 00, sampled, traceparent header.
+func formatTraceParent(traceID TraceID, spanID SpanID) string {
+	return fmt.Sprintf("00-%s-%s-01", traceID, spanID)
+}
+
+func parseTraceParent(header string) (traceID TraceID, spanID SpanID, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return traceID, spanID, false
+	}
+	if !decodeHex(traceID[:], parts[1]) || !decodeHex(spanID[:], parts[2]) {
+		return traceID, spanID, false
+	}
+	if traceID == (TraceID{}) || spanID == (SpanID{}) {
+		return traceID, spanID, false
+	}
+	return traceID, spanID, true
+}
+
+func decodeHex(dst []byte, s string) bool {
+	if hex.EncodedLen(len(dst)) != len(s) {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
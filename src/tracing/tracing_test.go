@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	ratelimit "github.com/gabehardgrave/ratelimit/src"
+	"github.com/gabehardgrave/ratelimit/src/internal/testutils"
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracer(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	tracer := &Tracer{Exporter: exporter}
+	client := &ratelimit.Client{
+		RetryAfterPolicy: ratelimit.RetryAfterDurationInHeader,
+		Options:          ratelimit.Options{Hooks: tracer.Hooks()},
+	}
+
+	var traceParents []string
+	b := testutils.Repeater(1)
+	client.C.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		traceParents = append(traceParents, req.Header.Get(TraceParentHeader))
+		if <-b {
+			return testutils.StubResponse(429, "", "Retry-After", "30"), nil
+		}
+		return testutils.StubResponse(200, ""), nil
+	})
+
+	req, _ := http.NewRequest("GET", "https://server.io/endpoint", nil)
+	req.Header.Set(TraceParentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	tyme.FreezeTimeAt(time.Now(), func() {
+		tyme.StubSleep(func(time.Duration) {}, func() {
+			resp, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, 200, resp.StatusCode)
+		})
+	})
+
+	// the caller's request is left alone
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		req.Header.Get(TraceParentHeader))
+
+	spans := exporter.Spans()
+	if !assert.Len(t, spans, 4) {
+		return
+	}
+	first, wait, second, request := spans[0], spans[1], spans[2], spans[3]
+
+	assert.Equal(t, []string{AttemptSpan, WaitSpan, AttemptSpan, RequestSpan},
+		[]string{first.Name, wait.Name, second.Name, request.Name})
+
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", request.TraceID.String())
+	assert.Equal(t, "b7ad6b7169203331", request.ParentID.String())
+	assert.Equal(t, 2, request.Attributes["ratelimit.attempts"])
+	assert.Equal(t, 200, request.Attributes["http.response.status_code"])
+
+	for _, span := range spans[:3] {
+		assert.Equal(t, request.TraceID, span.TraceID)
+		assert.Equal(t, request.SpanID, span.ParentID)
+	}
+
+	assert.Equal(t, 429, first.Attributes["http.response.status_code"])
+	assert.Equal(t, "30", first.Attributes["http.response.header.retry-after"])
+	assert.Equal(t, true, first.Attributes["ratelimit.retry"])
+	assert.Equal(t, 30*time.Second, wait.End.Sub(wait.Start))
+	assert.Equal(t, 200, second.Attributes["http.response.status_code"])
+	assert.Equal(t, false, second.Attributes["ratelimit.retry"])
+
+	// each attempt propagates its own span
+	assert.Equal(t, []string{
+		formatTraceParent(first.TraceID, first.SpanID),
+		formatTraceParent(second.TraceID, second.SpanID),
+	}, traceParents)
+}
+
+func TestParseTraceParent(t *testing.T) {
+	_, _, ok := parseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	assert.True(t, ok)
+
+	for _, bad := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-nothexnothexnoth-01",
+	} {
+		_, _, ok := parseTraceParent(bad)
+		assert.False(t, ok, bad)
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Transport is an http.RoundTripper that retries requests and honors rate limits. It allows any
+// http.Client (including those buried inside third party SDKs) to gain the behavior of
+// ratelimit.Client:
+//
+//	client := &http.Client{Transport: &ratelimit.Transport{PerHost: true}}
+//
+// The zero value uses http.DefaultTransport, and uses the IdiomaticRetryAfter RetryAfterPolicy.
+type Transport struct {
+
+	// Base is the http.RoundTripper used to make HTTP requests. If Base is nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// RetryAfterPolicy is the policy used to determine when to retry, and for how long to wait
+	// before retrying. If RetryAfterPolicy is nil, the Transport will use IdiomaticRetryAfter.
+	RetryAfterPolicy RetryAfterPolicy
+
+	// Options configure retries, and the client side rate limits enforced on top of the server's.
+	// If PerHost is set, Limit, Adaptive, and MaxConcurrency apply separately to each host. See
+	// Options.
+	Options
+
+	// PerHost determines whether rate limits are tracked separately per host (like
+	// MultiHostClient), or shared by all requests (like Client).
+	PerHost bool
+
+	// KeyFunc, if set, decides which requests share rate limits when PerHost is set. If KeyFunc
+	// is nil, requests are keyed by host (see HostKey).
+	KeyFunc KeyFunc
+
+	// MaxHosts is the maximum number of hosts (or keys) tracked at once when PerHost is set. Past
+	// it, the least recently used host is forgotten. Hosts with requests in flight or waiting
+	// aren't forgotten, so MaxHosts may be briefly exceeded, and hosts still waiting on a server
+	// imposed Retry-After are only forgotten if no others can be. Zero means no limit.
+	MaxHosts int
+
+	// HostIdleTTL is how long a host may go without requests before it's forgotten, when PerHost
+	// is set. Hosts are never forgotten while a server imposed Retry-After is still pending, or
+	// while requests to them are in flight or waiting. Zero means hosts are never forgotten for
+	// being idle.
+	HostIdleTTL time.Duration
+
+	single   hostEntry
+	limiters hostRateLimiterMap
+}
+
+// RoundTrip implements http.RoundTripper. Like all RoundTrippers, it does not modify req. Any
+// retries are sent using a clone of req.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	key := requestHost(req)
+	host := &t.single
+	var release func()
+	if t.PerHost {
+		key = t.key(req)
+		host, release = t.limiters.Host(key, t.MaxHosts, t.HostIdleTTL)
+	}
+	host.limiter.setBudget(t.Limit, t.Adaptive)
+
+	opts := t.doOptions(t.RetryAfterPolicy)
+	opts.sem = &host.sem
+	opts.statuses = &host.statuses
+	opts.key = key
+	resp, err := host.limiter.do(req.Clone(req.Context()), t.base().RoundTrip, opts)
+	if release != nil {
+		holdUntilClosed(resp, err, release)
+	}
+
+	// RoundTrippers must always close the request body, even on errors. If do failed before
+	// sending anything (e.g. while waiting on rate limits), nobody else will.
+	if resp == nil && err != nil && req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	// Unlike http.Client, RoundTrippers must return either a response or an error. Once retries
+	// are exhausted, the last response is still the best answer we have.
+	if resp != nil && err != nil {
+		var exhausted *RetriesExhaustedError
+		if errors.As(err, &exhausted) {
+			return resp, nil
+		}
+		_ = resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, err
+}
+
+// CloseIdleConnections closes any idle connections held by Base, if Base supports it.
+func (t *Transport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if ci, ok := t.base().(closeIdler); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+// ForgetHost discards any rate limits tracked for host (or for a key returned by KeyFunc). It has
+// no effect unless PerHost is set.
+func (t *Transport) ForgetHost(host string) {
+	t.limiters.forget(host)
+}
+
+// Snapshot lists the hosts (or keys) currently tracked, along with their state, most recently used
+// first. It's empty unless PerHost is set.
+func (t *Transport) Snapshot() []HostState {
+	return t.limiters.snapshot(CircuitBreaker{})
+}
+
+func (t *Transport) key(req *http.Request) string {
+	if t.KeyFunc == nil {
+		return requestHost(req)
+	}
+	return t.KeyFunc(req)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gabehardgrave/ratelimit/src/internal/testutils"
+	"github.com/gabehardgrave/ratelimit/src/internal/tyme"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransportRetries(t *testing.T) {
+	b := testutils.Repeater(2)
+
+	transport := &Transport{
+		RetryAfterPolicy: retryImmedietly,
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "the body", bod(req))
+			if <-b {
+				return testutils.StubResponse(429, "rate limited"), nil
+			}
+			return testutils.StubResponse(200, "success"), nil
+		}),
+	}
+	c := http.Client{Transport: transport}
+
+	req, _ := http.NewRequest("POST", "https://server.io/endpoint", toReader("the body"))
+	req.Header.Set("Content-Type", "text")
+	body := req.Body
+
+	resp, err := c.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, body, req.Body) // RoundTrippers must not modify the request
+}
+
+func TestTransportPerHostRateLimiting(t *testing.T) {
+	b1 := testutils.Repeater(1)
+	b2 := testutils.Repeater(1)
+
+	transport := &Transport{
+		RetryAfterPolicy: RetryAfterDurationInHeader,
+		PerHost:          true,
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			switch req.URL.Host {
+			case "site1.com":
+				if <-b1 {
+					return testutils.StubResponse(429, "", "Retry-After", "10"), nil
+				}
+			case "site2.com":
+				if <-b2 {
+					return testutils.StubResponse(429, "", "Retry-After", "5"), nil
+				}
+			}
+			return testutils.StubResponse(200, ""), nil
+		}),
+	}
+	c := http.Client{Transport: transport}
+
+	now := time.Now()
+	tyme.FreezeTimeAt(now, func() {
+		tyme.StubSleep(expectSleep(t, 10*time.Second), func() {
+			resp, _ := c.Get("https://site1.com/index")
+			assert.Equal(t, 200, resp.StatusCode)
+		})
+	})
+
+	tyme.FreezeTimeAt(now, func() {
+		tyme.StubSleep(expectSleep(t, 5*time.Second), func() {
+			resp, _ := c.Get("https://site2.com/index")
+			assert.Equal(t, 200, resp.StatusCode)
+		})
+	})
+}
+
+func TestTransportMaxRetries(t *testing.T) {
+	requests := 0
+	transport := &Transport{
+		RetryAfterPolicy: retryImmedietly,
+		Options:          Options{MaxRetries: 1},
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			requests += 1
+			return testutils.StubResponse(500, "oops"), nil
+		}),
+	}
+	c := http.Client{Transport: transport}
+
+	resp, err := c.Get("https://server.io/endpoint")
+	assert.Nil(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.Equal(t, 2, requests)
+}
+
+func TestTransportClosesBodyOnError(t *testing.T) {
+	requests := 0
+	transport := &Transport{
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			requests += 1
+			return testutils.StubResponse(200, ""), nil
+		}),
+	}
+	transport.single.limiter.SetRetryAfterTime(time.Now().Add(2 * time.Minute))
+	c := http.Client{Transport: transport}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	body := &closeTracker{Reader: toReader("the body")}
+	req, _ := http.NewRequestWithContext(ctx, "POST", "https://server.io/endpoint", body)
+
+	_, err := c.Do(req)
+	var deadlineErr *RetryAfterDeadlineError
+	assert.ErrorAs(t, err, &deadlineErr)
+	assert.Equal(t, 0, requests)
+	assert.True(t, body.closed)
+}
+
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func expectSleep(t *testing.T, expected time.Duration) func(time.Duration) {
+	return func(d time.Duration) {
+		if d > 0 {
+			assert.Equal(t, expected, d)
+		}
+	}
+}